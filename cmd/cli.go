@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/config"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/handlers"
+)
+
+// cli initializes and returns a root cobra command with the subcommands that run before the tables are opened.
+func cli(app *config.AppConfig) *cobra.Command {
+	repo := handlers.NewRepo(app)
+	handlers.NewHandlers(repo)
+	var rootCmd = &cobra.Command{Use: "go-dbms-lab"}
+
+	var cmdMigrate = &cobra.Command{
+		Use:   "migrate [--dry-run]",
+		Short: "Rewrites the table files in the layout of the schemas in the catalog.",
+		Args:  cobra.NoArgs,
+		Run:   handlers.Repo.Migrate,
+	}
+	cmdMigrate.Flags().Bool("dry-run", false, "report the changes without rewriting any file")
+
+	rootCmd.AddCommand(cmdMigrate)
+
+	return rootCmd
+}
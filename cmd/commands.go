@@ -3,26 +3,55 @@ package main
 import (
 	"github.com/spf13/cobra"
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/config"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/driver"
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/handlers"
+	"strings"
 )
 
+// usage returns the usage line of a command taking one argument per field of the default table.
+func usage(command string, table *driver.Table) string {
+	if table == nil {
+		return command + " <value>..."
+	}
+
+	args := []string{command}
+	for _, field := range table.Schema.Fields {
+		args = append(args, "<"+field.Name+">")
+	}
+
+	return strings.Join(args, " ")
+}
+
+// insertUsage returns the usage line of an insert command, where the key is optional for tables with an
+// auto-increment sequence.
+func insertUsage(command string, table *driver.Table) string {
+	line := usage(command, table)
+	if table != nil && table.Schema.AutoIncrement {
+		key := "<" + table.Schema.Fields[0].Name + ">"
+		line = strings.Replace(line, key, "["+key+"]", 1)
+	}
+
+	return line
+}
+
 // commands initializes and returns a root cobra command with all subcommands configured.
 func commands(app *config.AppConfig) *cobra.Command {
 	repo := handlers.NewRepo(app)
 	handlers.NewHandlers(repo)
 	var rootCmd = &cobra.Command{}
+	rootCmd.PersistentFlags().StringP(handlers.TableFlag, "t", "", "table to use instead of the default one")
 
 	var cmdInsertM = &cobra.Command{
-		Use:   "insert-m <id> <title> <category> <instructor>",
+		Use:   insertUsage("insert-m", app.Master),
 		Short: "Inserts a record into the master table.",
-		Args:  cobra.ExactArgs(4),
+		Args:  cobra.MinimumNArgs(1),
 		Run:   handlers.Repo.InsertMaster,
 	}
 
 	var cmdInsertS = &cobra.Command{
-		Use:   "insert-s <id> <course_id> <issued_to>",
+		Use:   insertUsage("insert-s", app.Slave),
 		Short: "Inserts a record into the slave table.",
-		Args:  cobra.ExactArgs(3),
+		Args:  cobra.MinimumNArgs(1),
 		Run:   handlers.Repo.InsertSlave,
 	}
 
@@ -55,28 +84,28 @@ func commands(app *config.AppConfig) *cobra.Command {
 	}
 
 	var cmdGetM = &cobra.Command{
-		Use:   "get-m <id> [field_name]",
+		Use:   "get-m <id|all|by <indexed_field> <value>> [field_name] [where <field> <op> <value>]",
 		Short: "Retrieves specific entries from the master table.",
 		Args:  cobra.MinimumNArgs(1),
 		Run:   handlers.Repo.GetMaster,
 	}
 
 	var cmdGetS = &cobra.Command{
-		Use:   "get-s <id> <course_id> [field_name]",
+		Use:   "get-s <id|all [master_id]> [field_name] [where <field> <op> <value>]",
 		Short: "Retrieves specific entries from the master table.",
 		Args:  cobra.MinimumNArgs(1),
 		Run:   handlers.Repo.GetSlave,
 	}
 
 	var cmdUpdateM = &cobra.Command{
-		Use:   "update-m <id> <title> <category> <instructor>",
+		Use:   usage("update-m", app.Master),
 		Short: "Updates fields of a record accessed by its ID.",
 		Args:  cobra.MinimumNArgs(2),
 		Run:   handlers.Repo.UpdateMaster,
 	}
 
 	var cmdUpdateS = &cobra.Command{
-		Use:   "update-s <id> <issued_to>",
+		Use:   usage("update-s", app.Slave),
 		Short: "Updates fields of a record accessed by its ID.",
 		Args:  cobra.MinimumNArgs(2),
 		Run:   handlers.Repo.UpdateSlave,
@@ -84,7 +113,7 @@ func commands(app *config.AppConfig) *cobra.Command {
 
 	var cmdDeleteM = &cobra.Command{
 		Use:   "del-m <id>",
-		Short: "Deletes entry by its ID.",
+		Short: "Deletes entry by its ID, along with its sub-records as the on-delete action of each slave table says.",
 		Args:  cobra.ExactArgs(1),
 		Run:   handlers.Repo.DeleteMaster,
 	}
@@ -96,6 +125,20 @@ func commands(app *config.AppConfig) *cobra.Command {
 		Run:   handlers.Repo.DeleteSlave,
 	}
 
+	var cmdRecount = &cobra.Command{
+		Use:   "recount",
+		Short: "Recounts the sub-records of every master record, repairing the counts kept in the master records.",
+		Args:  cobra.NoArgs,
+		Run:   handlers.Repo.Recount,
+	}
+
+	var cmdSearch = &cobra.Command{
+		Use:   "search <words>...",
+		Short: "Searches the master table by words in its searchable field.",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   handlers.Repo.Search,
+	}
+
 	rootCmd.AddCommand(cmdInsertM)
 	rootCmd.AddCommand(cmdCalcM)
 	rootCmd.AddCommand(cmdUtM)
@@ -109,6 +152,97 @@ func commands(app *config.AppConfig) *cobra.Command {
 	rootCmd.AddCommand(cmdGetS)
 	rootCmd.AddCommand(cmdUpdateS)
 	rootCmd.AddCommand(cmdDeleteS)
+	rootCmd.AddCommand(cmdRecount)
+
+	// Values can be negative numbers, so flags are only parsed before the first argument of these commands.
+	for _, cmd := range []*cobra.Command{cmdInsertM, cmdInsertS, cmdGetM, cmdGetS, cmdUpdateM, cmdUpdateS} {
+		cmd.Flags().SetInterspersed(false)
+	}
+
+	var cmdLink = &cobra.Command{
+		Use:   "link <junction> <id> <id> [<value>...]",
+		Short: "Links two records through a junction table, given by their IDs in the order of its links.",
+		Args:  cobra.MinimumNArgs(3),
+		Run:   handlers.Repo.Link,
+	}
+
+	var cmdUnlink = &cobra.Command{
+		Use:   "unlink <junction> <id> <id>",
+		Short: "Removes the link between two records from a junction table.",
+		Args:  cobra.ExactArgs(3),
+		Run:   handlers.Repo.Unlink,
+	}
+
+	var cmdLinked = &cobra.Command{
+		Use:   "linked <junction> <table> <id> [field_name] [where <field> <op> <value>]",
+		Short: "Lists the records linked through a junction table to the record of the table with the given ID.",
+		Args:  cobra.MinimumNArgs(3),
+		Run:   handlers.Repo.Linked,
+	}
+
+	rootCmd.AddCommand(cmdLink)
+	rootCmd.AddCommand(cmdUnlink)
+	rootCmd.AddCommand(cmdLinked)
+
+	// Values of the other fields of a link and of where clauses can be negative numbers as well.
+	for _, cmd := range []*cobra.Command{cmdLink, cmdLinked} {
+		cmd.Flags().SetInterspersed(false)
+	}
+
+	var cmdCreateTable = &cobra.Command{
+		Use: "create-table <name> <column>:<type>... [--key <column>] [--parent <table> --parent-field <column>] " +
+			"[--on-delete <cascade|restrict|set-null>] [--link <column>:<table> --link <column>:<table>] " +
+			"[--auto-increment] [--unique <column>,...]...",
+		Short: "Creates a table with the given columns, e.g. title:text(50) or id:uint32.",
+		Args:  cobra.MinimumNArgs(2),
+		Run:   handlers.Repo.CreateTable,
+	}
+	cmdCreateTable.Flags().String("key", "", "key column, the first column by default")
+	cmdCreateTable.Flags().String("parent", "", "master table of the new table")
+	cmdCreateTable.Flags().String("parent-field", "", "column holding the ID of the master record")
+	cmdCreateTable.Flags().String("on-delete", "cascade", "what deleting a master record does to its sub-records: "+
+		"cascade, restrict or set-null")
+	cmdCreateTable.Flags().StringArray("link", nil, "column holding the IDs of a linked table, as <column>:<table>, "+
+		"given twice for a junction table")
+	cmdCreateTable.Flags().Bool("auto-increment", false, "assign the keys of new records from a sequence")
+	cmdCreateTable.Flags().StringArray("unique", nil, "columns no two records can share the values of, repeatable")
+
+	var cmdAlterTable = &cobra.Command{
+		Use: "alter-table <name> <add <column>:<type>|drop <column>|resize <column> <size>|nullable <column>|" +
+			"auto-increment <on|off>|unique <column>,...|drop-unique <column>,...|on-delete <cascade|restrict|set-null>>",
+		Short: "Changes the columns, the auto-increment sequence, the unique constraints or the on-delete action of a table.",
+		Args:  cobra.RangeArgs(3, 4),
+		Run:   handlers.Repo.AlterTable,
+	}
+
+	var cmdShow = &cobra.Command{
+		Use:   "show tables",
+		Short: "Lists every table of the catalog.",
+		Args:  cobra.ExactArgs(1),
+		Run:   handlers.Repo.ShowTables,
+	}
+
+	var cmdDescribe = &cobra.Command{
+		Use:   "describe <table>",
+		Short: "Prints the columns of a table.",
+		Args:  cobra.ExactArgs(1),
+		Run:   handlers.Repo.Describe,
+	}
+
+	var cmdValidation = &cobra.Command{
+		Use:   "validation [strict|lenient]",
+		Short: "Prints or sets how text values that don't fit their fields are handled.",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   handlers.Repo.Validation,
+	}
+
+	rootCmd.AddCommand(cmdSearch)
+	rootCmd.AddCommand(cmdValidation)
+
+	rootCmd.AddCommand(cmdCreateTable)
+	rootCmd.AddCommand(cmdAlterTable)
+	rootCmd.AddCommand(cmdShow)
+	rootCmd.AddCommand(cmdDescribe)
 
 	return rootCmd
 }
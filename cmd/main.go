@@ -13,23 +13,26 @@ import (
 var app config.AppConfig
 
 func main() {
-	fmt.Println("program started")
-
-	masterName := "courses"
-	slaveName := "certificates"
-
-	master, err := driver.CreateTable(masterName, models.Course{}, false)
+	schemas, err := driver.LoadCatalog(models.Defaults)
 	if err != nil {
 		log.Fatal(err)
 	}
+	app.Schemas = schemas
+
+	if len(os.Args) > 1 {
+		if err := cli(&app).Execute(); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Println("program started")
 
-	slave, err := driver.CreateTable(slaveName, models.Certificate{}, true)
+	tables, err := driver.OpenTables(schemas)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	app.Master = master
-	app.Slave = slave
+	app.SetTables(schemas, tables)
 
 	rootCmd := commands(&app)
 	reader := bufio.NewReader(os.Stdin)
@@ -39,13 +42,10 @@ func main() {
 		log.Fatal(err)
 	}
 
-	err = driver.WriteServiceData(masterName, app.Master.Indices, app.Master.Junk, false)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	err = driver.WriteServiceData(slaveName, app.Slave.Indices, app.Slave.Junk, true)
-	if err != nil {
-		log.Fatal(err)
+	for _, table := range app.Tables {
+		err = table.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 }
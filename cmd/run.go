@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/kballard/go-shellquote"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"strings"
 )
 
@@ -30,9 +31,30 @@ func run(rootCmd *cobra.Command, reader *bufio.Reader) error {
 			continue
 		}
 
+		resetFlags(rootCmd)
 		rootCmd.SetArgs(args)
 		if err := rootCmd.Execute(); err != nil {
 			fmt.Printf("error executing command: %v\n", err)
 		}
 	}
 }
+
+// resetFlags restores the default values of the flags of the command and its subcommands, so that flags given to
+// one command don't carry over to the next one.
+func resetFlags(cmd *cobra.Command) {
+	reset := func(flag *pflag.Flag) {
+		// Setting the default of a slice flag would append to it rather than replace it.
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			_ = slice.Replace(nil)
+		} else {
+			_ = flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
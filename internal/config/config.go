@@ -2,10 +2,46 @@ package config
 
 import (
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/driver"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
 )
 
-// AppConfig holds application connections to Master and Slave files.
+// AppConfig holds application connections to every table of the catalog, along with their schemas. Master and Slave
+// are the tables the -m and -s commands use unless another table is given. Validation decides how text values that
+// don't fit their fields are handled.
 type AppConfig struct {
 	Master *driver.Table
 	Slave  *driver.Table
+
+	Tables  []*driver.Table
+	Schemas []*models.Schema
+
+	Validation models.Validation
+}
+
+// SetTables replaces the open tables and their schemas. The first master table of the catalog and its first slave
+// table become the default ones.
+func (a *AppConfig) SetTables(schemas []*models.Schema, tables []*driver.Table) {
+	a.Schemas = schemas
+	a.Tables = tables
+	a.Master = nil
+	a.Slave = nil
+
+	for _, table := range tables {
+		if table.Schema.IsMaster() && !table.Schema.IsSlave() {
+			a.Master = table
+			a.Slave = table.Children[0]
+			return
+		}
+	}
+}
+
+// Table returns the open table with the given name, or nil if there is none.
+func (a *AppConfig) Table(name string) *driver.Table {
+	for _, table := range a.Tables {
+		if table.Schema.Name == name {
+			return table
+		}
+	}
+
+	return nil
 }
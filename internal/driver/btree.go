@@ -0,0 +1,589 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	PageSize = 4096
+	NoPage   = 0
+)
+
+// nodeHeaderSize is the size of the Leaf, N and Next fields at the start of every node page.
+const nodeHeaderSize = 7
+
+// btreeMeta is stored in page 0 of the tree file, after the file header.
+type btreeMeta struct {
+	Root     uint32
+	Pages    uint32
+	FreePage uint32
+	KeySize  uint16
+	Count    uint32
+}
+
+// node is the in-memory form of a tree page. Leaves hold one value per key and are chained through Next, internal
+// nodes hold one more child page than keys.
+type node struct {
+	id     uint32
+	leaf   bool
+	next   uint32
+	keys   [][]byte
+	values []uint32
+}
+
+// BTree is a B+tree stored in a paged file. Keys are fixed-size byte strings compared lexicographically and values
+// are 32-bit addresses. Pages are written through writeData, so changes made inside a transaction are logged.
+type BTree struct {
+	file    *os.File
+	header  FileHeader
+	meta    btreeMeta
+	maxKeys int
+}
+
+// OpenBTree opens the tree stored in the given file, initializing an empty tree if the file is empty. The header of
+// an existing file must match the given one.
+func OpenBTree(file *os.File, keySize int, header FileHeader) (*BTree, error) {
+	t := &BTree{
+		file:    file,
+		header:  header,
+		maxKeys: (PageSize - nodeHeaderSize - 4) / (keySize + 4),
+	}
+
+	size, err := fileSize(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if size == 0 {
+		return t, t.init(keySize)
+	}
+
+	if err := verifyHeader(file, header); err != nil {
+		return nil, err
+	}
+
+	if err := t.readMeta(); err != nil {
+		return nil, err
+	}
+
+	if int(t.meta.KeySize) != keySize {
+		return nil, fmt.Errorf("%s has key size %d, expected %d", file.Name(), t.meta.KeySize, keySize)
+	}
+
+	return t, nil
+}
+
+// init writes the file header, the meta page and an empty root leaf.
+func (t *BTree) init(keySize int) error {
+	t.meta = btreeMeta{Root: 1, Pages: 2, KeySize: uint16(keySize)}
+
+	if err := WriteHeader(t.file, t.header); err != nil {
+		return err
+	}
+
+	if err := t.writeNode(&node{id: 1, leaf: true}); err != nil {
+		return err
+	}
+
+	return t.writeMeta()
+}
+
+// Reset removes every key from the tree.
+func (t *BTree) Reset() error {
+	if err := TruncateFile(t.file, 0); err != nil {
+		return err
+	}
+
+	return t.init(int(t.meta.KeySize))
+}
+
+// Reload rereads the meta page, e.g. after the file was restored by a rollback.
+func (t *BTree) Reload() error {
+	return t.readMeta()
+}
+
+// Len returns the number of keys in the tree.
+func (t *BTree) Len() int {
+	return int(t.meta.Count)
+}
+
+// Get performs a point lookup of the key.
+func (t *BTree) Get(key []byte) (uint32, bool, error) {
+	n, err := t.findLeaf(key)
+	if err != nil {
+		return 0, false, err
+	}
+
+	i, found := n.search(key)
+	if !found {
+		return 0, false, nil
+	}
+
+	return n.values[i], true, nil
+}
+
+// Last returns the largest key of the tree, reporting false if the tree is empty.
+func (t *BTree) Last() ([]byte, bool, error) {
+	n, err := t.readNode(t.meta.Root)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for !n.leaf {
+		n, err = t.readNode(n.values[len(n.values)-1])
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	if len(n.keys) == 0 {
+		return nil, false, nil
+	}
+
+	return n.keys[len(n.keys)-1], true, nil
+}
+
+// Scan calls fn for every key greater than or equal to from in ascending order until fn returns false. A nil from
+// starts at the smallest key.
+func (t *BTree) Scan(from []byte, fn func(key []byte, value uint32) bool) error {
+	n, err := t.findLeaf(from)
+	if err != nil {
+		return err
+	}
+
+	i := 0
+	if from != nil {
+		i, _ = n.search(from)
+	}
+
+	for {
+		for ; i < len(n.keys); i++ {
+			if !fn(n.keys[i], n.values[i]) {
+				return nil
+			}
+		}
+
+		if n.next == NoPage {
+			return nil
+		}
+
+		n, err = t.readNode(n.next)
+		if err != nil {
+			return err
+		}
+		i = 0
+	}
+}
+
+// Insert adds the key to the tree or replaces its value if it's already present.
+func (t *BTree) Insert(key []byte, value uint32) error {
+	root, err := t.readNode(t.meta.Root)
+	if err != nil {
+		return err
+	}
+
+	added, splitKey, newPage, err := t.insert(root, key, value)
+	if err != nil {
+		return err
+	}
+
+	if newPage != NoPage {
+		id, err := t.allocate()
+		if err != nil {
+			return err
+		}
+
+		newRoot := &node{id: id, keys: [][]byte{splitKey}, values: []uint32{root.id, newPage}}
+		if err := t.writeNode(newRoot); err != nil {
+			return err
+		}
+		t.meta.Root = id
+	}
+
+	if added {
+		t.meta.Count++
+	}
+
+	return t.writeMeta()
+}
+
+// insert adds the key to the subtree rooted at n. If n had to be split, it returns the separator key and the page
+// of the new right sibling.
+func (t *BTree) insert(n *node, key []byte, value uint32) (bool, []byte, uint32, error) {
+	added := true
+
+	if n.leaf {
+		i, found := n.search(key)
+		if found {
+			n.values[i] = value
+			added = false
+		} else {
+			n.keys = insertAt(n.keys, i, bytes.Clone(key))
+			n.values = insertAt(n.values, i, value)
+		}
+	} else {
+		i := n.child(key)
+		child, err := t.readNode(n.values[i])
+		if err != nil {
+			return false, nil, NoPage, err
+		}
+
+		var splitKey []byte
+		var newPage uint32
+		added, splitKey, newPage, err = t.insert(child, key, value)
+		if err != nil || newPage == NoPage {
+			return added, nil, NoPage, err
+		}
+
+		n.keys = insertAt(n.keys, i, splitKey)
+		n.values = insertAt(n.values, i+1, newPage)
+	}
+
+	if len(n.keys) <= t.maxKeys {
+		return added, nil, NoPage, t.writeNode(n)
+	}
+
+	splitKey, right, err := t.split(n)
+	if err != nil {
+		return false, nil, NoPage, err
+	}
+
+	return added, splitKey, right.id, nil
+}
+
+// split moves the upper half of an overflowing node into a new right sibling.
+func (t *BTree) split(n *node) ([]byte, *node, error) {
+	id, err := t.allocate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mid := len(n.keys) / 2
+	right := &node{id: id, leaf: n.leaf}
+	var splitKey []byte
+
+	if n.leaf {
+		right.keys = append(right.keys, n.keys[mid:]...)
+		right.values = append(right.values, n.values[mid:]...)
+		right.next = n.next
+		n.keys, n.values, n.next = n.keys[:mid], n.values[:mid], id
+		splitKey = right.keys[0]
+	} else {
+		splitKey = n.keys[mid]
+		right.keys = append(right.keys, n.keys[mid+1:]...)
+		right.values = append(right.values, n.values[mid+1:]...)
+		n.keys, n.values = n.keys[:mid], n.values[:mid+1]
+	}
+
+	if err := t.writeNode(n); err != nil {
+		return nil, nil, err
+	}
+
+	if err := t.writeNode(right); err != nil {
+		return nil, nil, err
+	}
+
+	return splitKey, right, nil
+}
+
+// Delete removes the key from the tree. It reports whether the key was present.
+func (t *BTree) Delete(key []byte) (bool, error) {
+	root, err := t.readNode(t.meta.Root)
+	if err != nil {
+		return false, err
+	}
+
+	found, err := t.delete(root, key)
+	if err != nil || !found {
+		return found, err
+	}
+
+	if !root.leaf && len(root.keys) == 0 {
+		t.meta.Root = root.values[0]
+		if err := t.free(root.id); err != nil {
+			return false, err
+		}
+	}
+
+	t.meta.Count--
+
+	return true, t.writeMeta()
+}
+
+// delete removes the key from the subtree rooted at n, rebalancing children that fall under half capacity.
+func (t *BTree) delete(n *node, key []byte) (bool, error) {
+	if n.leaf {
+		i, found := n.search(key)
+		if !found {
+			return false, nil
+		}
+
+		n.keys = removeAt(n.keys, i)
+		n.values = removeAt(n.values, i)
+
+		return true, t.writeNode(n)
+	}
+
+	i := n.child(key)
+	child, err := t.readNode(n.values[i])
+	if err != nil {
+		return false, err
+	}
+
+	found, err := t.delete(child, key)
+	if err != nil || !found {
+		return found, err
+	}
+
+	if len(child.keys) >= t.maxKeys/2 {
+		return true, nil
+	}
+
+	return true, t.rebalance(n, i, child)
+}
+
+// rebalance refills the underflowing child at position i of n, either by borrowing a key from a sibling or by
+// merging with it.
+func (t *BTree) rebalance(n *node, i int, child *node) error {
+	if i > 0 {
+		left, err := t.readNode(n.values[i-1])
+		if err != nil {
+			return err
+		}
+
+		if len(left.keys) > t.maxKeys/2 {
+			last := len(left.keys) - 1
+			if child.leaf {
+				child.keys = insertAt(child.keys, 0, left.keys[last])
+				child.values = insertAt(child.values, 0, left.values[last])
+				left.keys, left.values = left.keys[:last], left.values[:last]
+				n.keys[i-1] = child.keys[0]
+			} else {
+				child.keys = insertAt(child.keys, 0, n.keys[i-1])
+				child.values = insertAt(child.values, 0, left.values[last+1])
+				n.keys[i-1] = left.keys[last]
+				left.keys, left.values = left.keys[:last], left.values[:last+1]
+			}
+
+			return t.writeNodes(left, child, n)
+		}
+
+		return t.merge(n, i-1, left, child)
+	}
+
+	right, err := t.readNode(n.values[i+1])
+	if err != nil {
+		return err
+	}
+
+	if len(right.keys) > t.maxKeys/2 {
+		if child.leaf {
+			child.keys = append(child.keys, right.keys[0])
+			child.values = append(child.values, right.values[0])
+			right.keys = removeAt(right.keys, 0)
+			right.values = removeAt(right.values, 0)
+			n.keys[i] = right.keys[0]
+		} else {
+			child.keys = append(child.keys, n.keys[i])
+			child.values = append(child.values, right.values[0])
+			n.keys[i] = right.keys[0]
+			right.keys = removeAt(right.keys, 0)
+			right.values = removeAt(right.values, 0)
+		}
+
+		return t.writeNodes(right, child, n)
+	}
+
+	return t.merge(n, i, child, right)
+}
+
+// merge appends the right node to the left one, whose position in n is i, and frees the right page.
+func (t *BTree) merge(n *node, i int, left, right *node) error {
+	if left.leaf {
+		left.next = right.next
+	} else {
+		left.keys = append(left.keys, n.keys[i])
+	}
+	left.keys = append(left.keys, right.keys...)
+	left.values = append(left.values, right.values...)
+
+	n.keys = removeAt(n.keys, i)
+	n.values = removeAt(n.values, i+1)
+
+	if err := t.free(right.id); err != nil {
+		return err
+	}
+
+	return t.writeNodes(left, n)
+}
+
+// findLeaf descends from the root to the leaf that may contain the key. A nil key leads to the leftmost leaf.
+func (t *BTree) findLeaf(key []byte) (*node, error) {
+	n, err := t.readNode(t.meta.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	for !n.leaf {
+		i := 0
+		if key != nil {
+			i = n.child(key)
+		}
+
+		n, err = t.readNode(n.values[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// search returns the position of the first key greater than or equal to the given one and whether it's equal.
+func (n *node) search(key []byte) (int, bool) {
+	i := sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(n.keys[i], key) >= 0 })
+	return i, i < len(n.keys) && bytes.Equal(n.keys[i], key)
+}
+
+// child returns the position of the child of an internal node that covers the key.
+func (n *node) child(key []byte) int {
+	return sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(key, n.keys[i]) < 0 })
+}
+
+// allocate returns a page for a new node, reusing freed pages first.
+func (t *BTree) allocate() (uint32, error) {
+	if t.meta.FreePage == NoPage {
+		t.meta.Pages++
+		return t.meta.Pages - 1, nil
+	}
+
+	id := t.meta.FreePage
+	freed, err := t.readNode(id)
+	if err != nil {
+		return NoPage, err
+	}
+	t.meta.FreePage = freed.next
+
+	return id, nil
+}
+
+// free puts the page on the free list.
+func (t *BTree) free(id uint32) error {
+	if err := t.writeNode(&node{id: id, leaf: true, next: t.meta.FreePage}); err != nil {
+		return err
+	}
+	t.meta.FreePage = id
+
+	return nil
+}
+
+// readMeta reads page 0 of the tree file.
+func (t *BTree) readMeta() error {
+	page := make([]byte, binary.Size(t.meta))
+	if _, err := t.file.ReadAt(page, HeaderSize); err != nil {
+		return fmt.Errorf("error reading %s meta page: %w", t.file.Name(), err)
+	}
+
+	return binary.Read(bytes.NewReader(page), binary.BigEndian, &t.meta)
+}
+
+// writeMeta writes page 0 of the tree file.
+func (t *BTree) writeMeta() error {
+	if err := writeData(t.file, &t.meta, HeaderSize, io.SeekStart); err != nil {
+		return fmt.Errorf("error writing %s meta page: %w", t.file.Name(), err)
+	}
+
+	return nil
+}
+
+// readNode decodes the node stored in the page.
+func (t *BTree) readNode(id uint32) (*node, error) {
+	page := make([]byte, PageSize)
+	if _, err := t.file.ReadAt(page, int64(id)*PageSize); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error reading %s page %d: %w", t.file.Name(), id, err)
+	}
+
+	n := &node{
+		id:   id,
+		leaf: page[0] == 1,
+		next: binary.BigEndian.Uint32(page[3:7]),
+	}
+
+	count := int(binary.BigEndian.Uint16(page[1:3]))
+	keySize := int(t.meta.KeySize)
+	if count > t.maxKeys+1 {
+		return nil, fmt.Errorf("%s page %d is corrupted", t.file.Name(), id)
+	}
+
+	offset := nodeHeaderSize
+	for i := 0; i < count; i++ {
+		n.keys = append(n.keys, bytes.Clone(page[offset:offset+keySize]))
+		offset += keySize
+	}
+
+	values := count
+	if !n.leaf {
+		values++
+	}
+	for i := 0; i < values; i++ {
+		n.values = append(n.values, binary.BigEndian.Uint32(page[offset:offset+4]))
+		offset += 4
+	}
+
+	return n, nil
+}
+
+// writeNode encodes the node into its page.
+func (t *BTree) writeNode(n *node) error {
+	page := make([]byte, PageSize)
+	if n.leaf {
+		page[0] = 1
+	}
+	binary.BigEndian.PutUint16(page[1:3], uint16(len(n.keys)))
+	binary.BigEndian.PutUint32(page[3:7], n.next)
+
+	offset := nodeHeaderSize
+	for _, key := range n.keys {
+		offset += copy(page[offset:], key)
+	}
+	for _, value := range n.values {
+		binary.BigEndian.PutUint32(page[offset:offset+4], value)
+		offset += 4
+	}
+
+	if err := writeData(t.file, page, int64(n.id)*PageSize, io.SeekStart); err != nil {
+		return fmt.Errorf("error writing %s page %d: %w", t.file.Name(), n.id, err)
+	}
+
+	return nil
+}
+
+// writeNodes writes every given node.
+func (t *BTree) writeNodes(nodes ...*node) error {
+	for _, n := range nodes {
+		if err := t.writeNode(n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertAt inserts the value into the slice at position i.
+func insertAt[T any](s []T, i int, value T) []T {
+	s = append(s, value)
+	copy(s[i+1:], s[i:])
+	s[i] = value
+	return s
+}
+
+// removeAt removes the element at position i from the slice.
+func removeAt[T any](s []T, i int) []T {
+	return append(s[:i], s[i+1:]...)
+}
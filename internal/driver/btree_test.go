@@ -0,0 +1,136 @@
+package driver
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestTree opens a tree of primary index keys in the file at the given path.
+func openTestTree(t *testing.T, path string) *BTree {
+	t.Helper()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+
+	tree, err := OpenBTree(file, IndexKeySize, NewHeader(KindIndex, IndexKeySize+4, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tree
+}
+
+// checkTree checks that the tree holds exactly the given keys, each with its key times two as its value, in
+// ascending order.
+func checkTree(t *testing.T, tree *BTree, want map[uint32]bool) {
+	t.Helper()
+
+	if tree.Len() != len(want) {
+		t.Fatalf("Len() = %d, want %d", tree.Len(), len(want))
+	}
+
+	for id := range want {
+		value, ok, err := tree.Get(IndexKey(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || value != id*2 {
+			t.Fatalf("Get(%d) = %d, %v, want %d, true", id, value, ok, id*2)
+		}
+	}
+
+	var previous uint32
+	seen := 0
+	err := tree.Scan(nil, func(key []byte, value uint32) bool {
+		id := binary.BigEndian.Uint32(key)
+		if seen > 0 && id <= previous {
+			t.Fatalf("Scan returned %d after %d", id, previous)
+		}
+		if !want[id] {
+			t.Fatalf("Scan returned %d, which isn't in the tree", id)
+		}
+		previous = id
+		seen++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != len(want) {
+		t.Fatalf("Scan returned %d keys, want %d", seen, len(want))
+	}
+}
+
+func TestBTreeInsertDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.ind")
+	tree := openTestTree(t, path)
+
+	const n = 5000
+	ids := rand.New(rand.NewSource(1)).Perm(n)
+	want := make(map[uint32]bool)
+
+	for _, i := range ids {
+		id := uint32(i + 1)
+		if err := tree.Insert(IndexKey(id), id*2); err != nil {
+			t.Fatal(err)
+		}
+		want[id] = true
+	}
+	checkTree(t, tree, want)
+
+	root, err := tree.readNode(tree.meta.Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.leaf {
+		t.Fatalf("root is still a leaf after %d inserts, expected the tree to split", n)
+	}
+
+	// Inserting a key again replaces its value without adding a key.
+	if err := tree.Insert(IndexKey(1), 2); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, tree, want)
+
+	for _, i := range ids {
+		id := uint32(i + 1)
+		if id%3 == 0 {
+			continue
+		}
+
+		found, err := tree.Delete(IndexKey(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found {
+			t.Fatalf("Delete(%d) didn't find the key", id)
+		}
+		delete(want, id)
+	}
+	checkTree(t, tree, want)
+
+	found, err := tree.Delete(IndexKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found {
+		t.Fatal("Delete found a key that was already deleted")
+	}
+
+	// The tree is kept on disk, so opening the file again finds the same keys.
+	checkTree(t, openTestTree(t, path), want)
+
+	for id := range want {
+		if _, err := tree.Delete(IndexKey(id)); err != nil {
+			t.Fatal(err)
+		}
+		delete(want, id)
+	}
+	checkTree(t, tree, want)
+}
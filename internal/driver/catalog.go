@@ -0,0 +1,181 @@
+package driver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+	"os"
+	"slices"
+)
+
+// CatalogName is the name of the catalog file listing the schemas of every table.
+const CatalogName = "dbms.catalog"
+
+// LoadCatalog reads the schemas of every table from the catalog file. If there is no catalog yet, it is created with
+// the given default schemas.
+func LoadCatalog(defaults []*models.Schema) ([]*models.Schema, error) {
+	data, err := os.ReadFile(CatalogName)
+	if errors.Is(err, os.ErrNotExist) {
+		return defaults, SaveCatalog(defaults)
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading catalog: %w", err)
+	}
+
+	var schemas []*models.Schema
+	if err := json.Unmarshal(data, &schemas); err != nil {
+		return nil, fmt.Errorf("error parsing catalog: %w", err)
+	}
+
+	if err := CheckCatalog(schemas); err != nil {
+		return nil, fmt.Errorf("error in catalog: %w", err)
+	}
+
+	return schemas, nil
+}
+
+// SaveCatalog replaces the catalog file with the given schemas. The catalog is written to a temporary file first, so
+// an interrupted save leaves the previous catalog intact.
+func SaveCatalog(schemas []*models.Schema) error {
+	if err := CheckCatalog(schemas); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(schemas, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding catalog: %w", err)
+	}
+
+	temp := CatalogName + ".tmp"
+	if err := os.WriteFile(temp, append(data, '\n'), 0666); err != nil {
+		return fmt.Errorf("error writing catalog: %w", err)
+	}
+
+	if err := os.Rename(temp, CatalogName); err != nil {
+		return fmt.Errorf("error replacing catalog: %w", err)
+	}
+
+	return nil
+}
+
+// FindSchema returns the schema of the table with the given name, or nil if there is none.
+func FindSchema(schemas []*models.Schema, name string) *models.Schema {
+	for _, schema := range schemas {
+		if schema.Name == name {
+			return schema
+		}
+	}
+
+	return nil
+}
+
+// CheckCatalog checks that every schema is valid, that table names are unique, that the relations between tables
+// are declared on both sides without cycles and that junction tables link tables that exist.
+func CheckCatalog(schemas []*models.Schema) error {
+	seen := make(map[string]bool)
+	for _, schema := range schemas {
+		if err := schema.Validate(); err != nil {
+			return err
+		}
+		if seen[schema.Name] {
+			return fmt.Errorf("table %s is declared twice", schema.Name)
+		}
+		seen[schema.Name] = true
+	}
+
+	for _, schema := range schemas {
+		if schema.IsSlave() {
+			parent := FindSchema(schemas, schema.Parent)
+			if parent == nil || !slices.Contains(parent.Children, schema.Name) {
+				return fmt.Errorf("%s is not declared as a slave table of %s", schema.Name, schema.Parent)
+			}
+		}
+
+		// A slave table can be the master table of other tables, as long as following the master tables up from
+		// it ends at a table that isn't a slave table.
+		ancestor := schema
+		for depth := 0; ancestor != nil && ancestor.IsSlave(); depth++ {
+			if depth == len(schemas) {
+				return fmt.Errorf("%s is its own master table through %s", schema.Name, schema.Parent)
+			}
+			ancestor = FindSchema(schemas, ancestor.Parent)
+		}
+
+		for _, child := range schema.Children {
+			slave := FindSchema(schemas, child)
+			if slave == nil || slave.Parent != schema.Name {
+				return fmt.Errorf("%s is not declared as the master table of %s", schema.Name, child)
+			}
+		}
+
+		for _, link := range schema.Links {
+			linked := FindSchema(schemas, link.Table)
+			if linked == nil {
+				return fmt.Errorf("table %s linked by %s was not found", link.Table, schema.Name)
+			}
+			if linked.IsSlave() || linked.IsJunction() {
+				return fmt.Errorf("%s can't link %s, only tables that are neither slave nor junction tables can be "+
+					"linked", schema.Name, linked.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// OpenTables opens every table of the catalog, relates slave tables to their master tables and junction tables to
+// the tables they link. Every file has been recovered from the write-ahead log by then, so the log is cleared. If any
+// table fails to open, the tables opened before it are closed again.
+func OpenTables(schemas []*models.Schema) ([]*Table, error) {
+	tables := make([]*Table, 0, len(schemas))
+	err := func() error {
+		for _, schema := range schemas {
+			table, err := CreateTable(schema)
+			if err != nil {
+				return err
+			}
+			tables = append(tables, table)
+		}
+
+		for _, slave := range tables {
+			if !slave.Schema.IsSlave() {
+				continue
+			}
+
+			for _, master := range tables {
+				if master.Schema.Name == slave.Schema.Parent {
+					if err := Relate(master, slave); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		for _, junction := range tables {
+			if junction.Schema.IsJunction() {
+				if err := Link(junction, tables); err != nil {
+					return err
+				}
+			}
+		}
+
+		return wal.clear()
+	}()
+	if err != nil {
+		return nil, errors.Join(err, CloseTables(tables))
+	}
+
+	return tables, nil
+}
+
+// CloseTables closes every given table without logging the service data written, as the tables are about to be
+// opened again.
+func CloseTables(tables []*Table) error {
+	for _, table := range tables {
+		if err := table.close(false); err != nil {
+			return fmt.Errorf("error closing %s: %w", table.Schema.Name, err)
+		}
+	}
+
+	return nil
+}
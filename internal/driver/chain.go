@@ -0,0 +1,306 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+)
+
+// Master reads the master record of the slave record, returning it along with its address.
+func (t *Table) Master(record *models.Record) (*models.Record, int64, error) {
+	if t.Parent == nil {
+		return nil, 0, fmt.Errorf("%s is not related to its master table", t.name)
+	}
+
+	key, ok := t.ParentKey(record)
+	if !ok {
+		return nil, 0, fmt.Errorf("record with ID %d of %s has no master record", record.Key(), t.name)
+	}
+
+	address, ok := t.Parent.GetAddressByIndex(key)
+	if !ok {
+		return nil, 0, fmt.Errorf("master record with ID %d was not found", key)
+	}
+
+	master, err := t.Parent.ReadRecord(int64(address))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading master record: %w", err)
+	}
+
+	return master, int64(address), nil
+}
+
+// updateChain applies the change to the chain of the slave record's master record and writes the master record.
+func (t *Table) updateChain(record *models.Record, change func(chain *models.Chain)) error {
+	master, masterAddress, err := t.Master(record)
+	if err != nil {
+		return err
+	}
+
+	change(t.Head(master))
+
+	return t.Parent.WriteRecord(masterAddress, master)
+}
+
+// Chain returns the addresses and records of the chain of subrecords starting at the given address.
+func (t *Table) Chain(first int64) ([]int64, []*models.Record, error) {
+	var addresses []int64
+	var records []*models.Record
+	visited := make(map[int64]bool)
+
+	for address := first; address != NoLink; {
+		if visited[address] {
+			return nil, nil, fmt.Errorf("linked list loops back to offset %d", address)
+		}
+		visited[address] = true
+
+		record, err := t.ReadRecord(address)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading slave record: %w", err)
+		}
+
+		addresses = append(addresses, address)
+		records = append(records, record)
+		address = record.Next
+	}
+
+	return addresses, records, nil
+}
+
+// Append writes the slave record at the given address, linking it to the end of the chain of its master record
+// through the tail of the chain and counting it. An orphan is written without being linked to any chain.
+func (t *Table) Append(record *models.Record, address int64) error {
+	record.Previous = NoLink
+	record.Next = NoLink
+
+	if _, ok := t.ParentKey(record); !ok {
+		return t.WriteRecord(address, record)
+	}
+
+	master, masterAddress, err := t.Master(record)
+	if err != nil {
+		return err
+	}
+
+	head := t.Head(master)
+	if head.First == NoLink {
+		head.First = address // first slave
+	} else {
+		last, err := t.ReadRecord(head.Last)
+		if err != nil {
+			return fmt.Errorf("error reading last slave record: %w", err)
+		}
+
+		last.Next = address
+		record.Previous = head.Last
+
+		if err := t.WriteRecord(head.Last, last); err != nil {
+			return fmt.Errorf("error updating last slave record: %w", err)
+		}
+	}
+	head.Last = address
+	head.Count++
+
+	if err := t.Parent.WriteRecord(masterAddress, master); err != nil {
+		return fmt.Errorf("error updating master record: %w", err)
+	}
+
+	return t.WriteRecord(address, record)
+}
+
+// Unlink removes the slave record from the chain of its master record, linking its neighbours to each other,
+// moving the head or the tail of the chain if the record was first or last and no longer counting it. The record
+// itself is left for the caller to write. Orphans belong to no chain and are left as they are.
+func (t *Table) Unlink(record *models.Record) error {
+	if _, ok := t.ParentKey(record); !ok {
+		return nil
+	}
+
+	err := t.updateChain(record, func(chain *models.Chain) {
+		if record.Previous == NoLink {
+			chain.First = record.Next
+		}
+		if record.Next == NoLink {
+			chain.Last = record.Previous
+		}
+		if chain.Count > 0 {
+			chain.Count--
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("error updating the chain: %w", err)
+	}
+
+	if record.Previous != NoLink {
+		previous, err := t.ReadRecord(record.Previous)
+		if err != nil {
+			return fmt.Errorf("error reading previous slave record: %w", err)
+		}
+
+		previous.Next = record.Next
+		if err := t.WriteRecord(record.Previous, previous); err != nil {
+			return fmt.Errorf("error updating previous slave record: %w", err)
+		}
+	}
+
+	if record.Next != NoLink {
+		next, err := t.ReadRecord(record.Next)
+		if err != nil {
+			return fmt.Errorf("error reading next slave record: %w", err)
+		}
+
+		next.Previous = record.Previous
+		if err := t.WriteRecord(record.Next, next); err != nil {
+			return fmt.Errorf("error updating next slave record: %w", err)
+		}
+	}
+
+	record.Previous = NoLink
+	record.Next = NoLink
+
+	return nil
+}
+
+// Reparent moves the slave record stored at the given address from the chain of the master record it had before the
+// update, given by old, to the end of the chain of its new master record, and writes it.
+func (t *Table) Reparent(old, record *models.Record, address int64) error {
+	if err := t.Unlink(old); err != nil {
+		return err
+	}
+
+	if err := t.Append(record, address); err != nil {
+		return fmt.Errorf("error linking slave record: %w", err)
+	}
+
+	return nil
+}
+
+// Orphan keeps every record of the chain starting at the given address, setting their parent field to NULL and
+// unlinking them from each other, and returns the number of records. The head of the chain in the master record is
+// left for the caller to update.
+func (t *Table) Orphan(first int64) (int, error) {
+	addresses, records, err := t.Chain(first)
+	if err != nil {
+		return 0, err
+	}
+
+	parent := t.Schema.FieldIndex(t.Schema.ParentField)
+	for i, record := range records {
+		if err := t.UnindexRecord(record); err != nil {
+			return 0, err
+		}
+
+		record.Values[parent] = nil
+		record.Previous = NoLink
+		record.Next = NoLink
+
+		if err := t.WriteRecord(addresses[i], record); err != nil {
+			return 0, fmt.Errorf("error updating orphaned record: %w", err)
+		}
+
+		if err := t.IndexRecord(record, uint32(addresses[i])); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(records), nil
+}
+
+// Recount follows the chain of every master record in the slave table, repairing the tail and the number of
+// subrecords kept in the master record where they drifted from the chain, and returns the number of master records
+// repaired.
+func (t *Table) Recount() (int, error) {
+	if t.Parent == nil {
+		return 0, fmt.Errorf("%s is not related to its master table", t.name)
+	}
+
+	entries, err := t.Parent.Entries()
+	if err != nil {
+		return 0, err
+	}
+
+	repaired := 0
+	for _, entry := range entries {
+		master, err := t.Parent.ReadRecord(int64(entry.Address))
+		if err != nil {
+			return 0, fmt.Errorf("error reading master record: %w", err)
+		}
+
+		head := t.Head(master)
+		addresses, _, err := t.Chain(head.First)
+		if err != nil {
+			return 0, err
+		}
+
+		last := int64(NoLink)
+		if len(addresses) > 0 {
+			last = addresses[len(addresses)-1]
+		}
+
+		if head.Last == last && int(head.Count) == len(addresses) {
+			continue
+		}
+		head.Last = last
+		head.Count = uint32(len(addresses))
+
+		if err := t.Parent.WriteRecord(int64(entry.Address), master); err != nil {
+			return 0, fmt.Errorf("error updating master record: %w", err)
+		}
+		repaired++
+	}
+
+	return repaired, nil
+}
+
+// DeleteRecord removes the record stored at the given address from the table and its indexes, releasing the heap
+// blocks of its varchar values. Records of a slave table are logically deleted and their address is added to the
+// junk, while the last record of a master table is moved into the freed slot so that the file stays dense.
+func (t *Table) DeleteRecord(record *models.Record, address int64) error {
+	if err := t.UnindexRecord(record); err != nil {
+		return err
+	}
+
+	if err := t.RemoveIndex(record.Key()); err != nil {
+		return err
+	}
+
+	t.releaseValues(record)
+
+	if t.withJunk {
+		deleted := t.NewRecord()
+		deleted.Presence = false
+		for i, field := range t.Schema.Fields {
+			if !field.IsText() {
+				deleted.Values[i] = record.Values[i]
+			}
+		}
+
+		if err := t.WriteRecord(address, deleted); err != nil {
+			return fmt.Errorf("error updating record to mark as deleted: %w", err)
+		}
+
+		t.Junk = append(t.Junk, uint32(address))
+		return nil
+	}
+
+	lastRecordAddress := int64(HeaderSize + t.NumberOfRecords()*t.Size)
+	if lastRecordAddress != address {
+		lastRecord, err := t.MoveRecord(lastRecordAddress, address)
+		if err != nil {
+			return fmt.Errorf("error moving entry: %w", err)
+		}
+
+		if err := t.UpdateAddress(lastRecord.Key(), uint32(address)); err != nil {
+			return err
+		}
+
+		if err := t.IndexRecord(lastRecord, uint32(address)); err != nil {
+			return err
+		}
+	}
+
+	if err := TruncateFile(t.FL, lastRecordAddress); err != nil {
+		return fmt.Errorf("error truncating file: %w", err)
+	}
+
+	return nil
+}
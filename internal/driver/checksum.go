@@ -0,0 +1,38 @@
+package driver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// ChecksumSize is the size of the CRC32C checksum that follows every record in the .fl file.
+const ChecksumSize = 4
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// CorruptionError reports a record whose checksum doesn't match its contents, e.g. after a torn write or a bit flip.
+type CorruptionError struct {
+	File   string
+	Offset int64
+}
+
+// Error implements the error interface.
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("record at offset %d of %s is corrupted", e.Offset, e.File)
+}
+
+// encodeFrame appends the CRC32C checksum of the encoded record to it.
+func encodeFrame(data []byte) []byte {
+	return binary.BigEndian.AppendUint32(data, crc32.Checksum(data, castagnoli))
+}
+
+// decodeFrame verifies the checksum of a frame read from the given file offset and returns the encoded record.
+func decodeFrame(file string, offset int64, frame []byte) ([]byte, error) {
+	data, sum := frame[:len(frame)-ChecksumSize], frame[len(frame)-ChecksumSize:]
+	if crc32.Checksum(data, castagnoli) != binary.BigEndian.Uint32(sum) {
+		return nil, &CorruptionError{File: file, Offset: offset}
+	}
+
+	return data, nil
+}
@@ -3,11 +3,12 @@ package driver
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
-	"io"
 	"log"
 	"os"
+	"slices"
 	"sort"
 )
 
@@ -16,177 +17,422 @@ const (
 	NoLink      = -1
 )
 
-// IndexTable defines the structure for index table entries, holding an index and its corresponding address.
+// IndexTable defines the structure for index entries, holding an index and its corresponding address.
 type IndexTable struct {
 	Index   uint32
 	Address uint32
 }
 
-// Table encapsulates file connection and indices for a table, along with the size of its model.
+// Table encapsulates file connection and indices for a table, along with its schema and the size of its records.
+// Parent and Children point to the tables it is related to as a slave and as a master, in the order of the schema.
+// Links points to the tables a junction table links, in the order of the schema, and Junctions to the junction tables
+// linking the table.
 type Table struct {
-	FL      *os.File
-	Indices []IndexTable
-	Junk    []uint32
-	Size    int
+	FL        *os.File
+	Index     *BTree
+	Secondary map[string]*SecondaryIndex
+	FullText  map[string]*FullTextIndex
+	Unique    []*UniqueIndex
+	Junk      []uint32
+	Size      int
+	Schema    *models.Schema
+	Parent    *Table
+	Children  []*Table
+	Links     []*Table
+	Junctions []*Table
+
+	name     string
+	layout   []LayoutField
+	heap     *Heap
+	sequence uint32
+	seq      *os.File
+	chain    int
+	withJunk bool
 }
 
-// NewTable initializes a new Table instance with given file connections and model size.
-func NewTable(fl *os.File, ind *os.File, jk *os.File, model any, withJunk bool) *Table {
-	size := binary.Size(model)
+// NewTable initializes a new Table instance with given file connections and schema. Headers are written to new
+// files, and existing files whose header doesn't match the schema are refused. If the .ind file is missing, the
+// index is rebuilt from a scan of the .fl file, as are the junk addresses of a slave table if the previous session
+// did not shut down cleanly.
+func NewTable(fl *os.File, ind *os.File, jk *os.File, schema *models.Schema) (*Table, error) {
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+
+	layout, err := SchemaLayout(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	withJunk := schema.IsSlave()
+	table := &Table{
+		FL:       fl,
+		Size:     RecordSize(layout),
+		Schema:   schema,
+		Children: make([]*Table, len(schema.Children)),
+		name:     schema.Name,
+		layout:   layout,
+		withJunk: withJunk,
+	}
+
+	missing, err := isMissing(fl, ind)
+	if err != nil {
+		return nil, err
+	}
 
-	indices, err := LoadIndices(ind)
+	dirty, err := wasDirty(fl)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	if err := checkHeader(fl, table.header(KindData, table.Size)); err != nil {
+		return nil, err
 	}
 
-	var junk []uint32
 	if withJunk {
-		junk, err = LoadJunk(jk)
-		if err != nil {
-			log.Fatal(err)
+		if err := checkHeader(jk, table.header(KindJunk, 4)); err != nil {
+			return nil, err
+		}
+	}
+
+	table.Index, err = OpenBTree(ind, IndexKeySize, table.header(KindIndex, IndexKeySize+4))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case missing:
+		log.Printf("index of %s is missing, rebuilding service data...\n", fl.Name())
+		err = table.rebuild()
+	case !withJunk:
+	case dirty:
+		log.Printf("%s was not closed cleanly, rebuilding unused addresses...\n", fl.Name())
+		_, table.Junk, err = table.ScanRecords()
+	default:
+		table.Junk, err = LoadJunk(jk)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := markOpen(fl); err != nil {
+		return nil, err
+	}
+
+	wal.register(table)
+
+	return table, nil
+}
+
+// header builds the header of a file of the table holding entries of the given size.
+func (t *Table) header(kind uint8, recordSize int) FileHeader {
+	return NewHeader(kind, recordSize, t.layout)
+}
+
+// rebuild reconstructs the index and junk addresses of the table from its .fl file.
+func (t *Table) rebuild() error {
+	indices, junk, err := t.ScanRecords()
+	if err != nil {
+		return err
+	}
+
+	if err := t.Index.Reset(); err != nil {
+		return fmt.Errorf("error resetting index: %w", err)
+	}
+
+	for _, entry := range indices {
+		if err := t.AddIndex(entry.Index, entry.Address); err != nil {
+			return err
 		}
 	}
 
-	return &Table{
-		FL:      fl,
-		Indices: indices,
-		Junk:    junk,
-		Size:    size,
+	if t.withJunk {
+		t.Junk = junk
 	}
+
+	return nil
 }
 
-// CreateTable creates files for a new table (.fl and .ind) based on the given name and model, returning the Table instance.
-func CreateTable(name string, model any, withJunk bool) (*Table, error) {
+// reload rereads the service data of the table after its files were restored by a rollback.
+func (t *Table) reload() error {
+	if err := t.Index.Reload(); err != nil {
+		return err
+	}
+
+	for _, index := range t.Secondary {
+		if err := index.tree.Reload(); err != nil {
+			return err
+		}
+	}
+
+	for _, index := range t.FullText {
+		if err := index.tree.Reload(); err != nil {
+			return err
+		}
+	}
+
+	for _, index := range t.Unique {
+		if err := index.tree.Reload(); err != nil {
+			return err
+		}
+	}
+
+	if t.heap != nil {
+		if err := t.rebuildHeap(); err != nil {
+			return err
+		}
+	}
+
+	if !t.withJunk {
+		return nil
+	}
+
+	_, junk, err := t.ScanRecords()
+	if err != nil {
+		return err
+	}
+	t.Junk = junk
+
+	return nil
+}
+
+// CreateTable creates files for a new table (.fl and .ind) based on the given schema, returning the Table instance
+// with the heap file of its varchar fields, its auto-increment sequence and the secondary, full-text and unique indexes
+// of the schema open. Operations left in the write-ahead log by an interrupted session are replayed against the .fl and .ind
+// files first.
+func CreateTable(schema *models.Schema) (*Table, error) {
+	name := schema.Name
+
 	flName := fmt.Sprintf("%s.fl", name)
 	flFile, err := os.OpenFile(flName, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return nil, fmt.Errorf("error creating .fl file: %w", err)
 	}
 
+	if err := recoverFile(flFile); err != nil {
+		return nil, fmt.Errorf("error replaying log for %s: %w", flName, err)
+	}
+	wal.track(flFile)
+
 	indName := fmt.Sprintf("%s.ind", name)
 	indFile, err := os.OpenFile(indName, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return nil, fmt.Errorf("error creating .ind file: %w", err)
 	}
-	defer indFile.Close()
+
+	if err := recoverFile(indFile); err != nil {
+		return nil, fmt.Errorf("error replaying log for %s: %w", indName, err)
+	}
+	wal.track(indFile)
 
 	var jkFile *os.File
 
-	if withJunk {
+	if schema.IsSlave() {
 		jkName := fmt.Sprintf("%s.jk", name)
 		jkFile, err = os.OpenFile(jkName, os.O_RDWR|os.O_CREATE, 0666)
 		if err != nil {
-			return nil, fmt.Errorf("error creating .ind file: %w", err)
+			return nil, fmt.Errorf("error creating .jk file: %w", err)
 		}
 		defer jkFile.Close()
 	}
 
-	table := NewTable(flFile, indFile, jkFile, model, withJunk)
+	table, err := NewTable(flFile, indFile, jkFile, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := table.openExtras(); err != nil {
+		return nil, errors.Join(err, table.close(false))
+	}
+
 	return table, nil
 }
 
-// ReadModel reads a model from the specified file at a given offset and position.
-func ReadModel(file *os.File, model any, offset int64, whence int) error {
-	if _, err := file.Seek(offset, whence); err != nil {
-		return fmt.Errorf("error reading model: %w", err)
+// openExtras opens the heap file of the varchar fields of the table, its auto-increment sequence and the secondary,
+// full-text and unique indexes of its schema.
+func (t *Table) openExtras() error {
+	schema := t.Schema
+
+	if hasVarText(schema) {
+		if err := t.OpenHeap(); err != nil {
+			return err
+		}
 	}
-	return binary.Read(file, binary.BigEndian, model)
-}
 
-// WriteModel writes a model's binary representation to a file at the specified offset and position.
-func WriteModel(file *os.File, model any, offset int64, whence int) error {
-	if _, err := file.Seek(offset, whence); err != nil {
-		return fmt.Errorf("error seeking file: %w", err)
+	if schema.AutoIncrement {
+		if err := t.openSequence(); err != nil {
+			return err
+		}
 	}
 
-	var binBuf bytes.Buffer
-	if err := binary.Write(&binBuf, binary.BigEndian, model); err != nil {
-		return fmt.Errorf("error writing model: %w", err)
+	for _, field := range schema.Indexed {
+		if err := t.OpenSecondaryIndex(field); err != nil {
+			return err
+		}
 	}
 
-	if _, err := file.Write(binBuf.Bytes()); err != nil {
-		return fmt.Errorf("error writing to file: %w", err)
+	for _, field := range schema.Searchable {
+		if err := t.OpenFullTextIndex(field); err != nil {
+			return err
+		}
 	}
 
+	if err := removeStaleUnique(schema); err != nil {
+		return err
+	}
+
+	for _, fields := range schema.Unique {
+		if err := t.OpenUniqueIndex(fields); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Relate links the slave table to its master table, so that chains of subrecords can be followed and fixed up
+// across the two.
+func Relate(master, slave *Table) error {
+	chain := slices.Index(master.Schema.Children, slave.Schema.Name)
+	if chain < 0 || slave.Schema.Parent != master.Schema.Name {
+		return fmt.Errorf("%s is not a slave table of %s", slave.Schema.Name, master.Schema.Name)
+	}
+
+	master.Children[chain] = slave
+	slave.Parent = master
+	slave.chain = chain
+
 	return nil
 }
 
-// MoveModel moves a model from one address to another.
-func MoveModel(flFile *os.File, model any, oldAddress, newAddress int64) error {
-	err := ReadModel(flFile, model, oldAddress, io.SeekStart)
+// Head returns the chain of the master record holding its subrecords in the slave table.
+func (t *Table) Head(master *models.Record) *models.Chain {
+	return &master.Chains[t.chain]
+}
+
+// ParentKey returns the key of the master record of the slave record. It reports false for an orphan, whose parent
+// field is NULL.
+func (t *Table) ParentKey(record *models.Record) (uint32, bool) {
+	key, ok := record.Values[t.Schema.FieldIndex(t.Schema.ParentField)].(uint32)
+	return key, ok
+}
+
+// readData reads unframed binary data from the specified file at a given offset and position.
+func readData(file *os.File, data any, offset int64, whence int) error {
+	if _, err := file.Seek(offset, whence); err != nil {
+		return fmt.Errorf("error reading data: %w", err)
+	}
+	return binary.Read(file, binary.BigEndian, data)
+}
+
+// writeData writes unframed binary data to a file at the specified offset and position.
+func writeData(file *os.File, data any, offset int64, whence int) error {
+	pos, err := file.Seek(offset, whence)
 	if err != nil {
-		return fmt.Errorf("error reading last record: %w", err)
+		return fmt.Errorf("error seeking file: %w", err)
+	}
+
+	var binBuf bytes.Buffer
+	if err := binary.Write(&binBuf, binary.BigEndian, data); err != nil {
+		return fmt.Errorf("error writing data: %w", err)
 	}
 
-	if err := WriteModel(flFile, model, newAddress, io.SeekStart); err != nil {
-		return fmt.Errorf("error moving last record: %w", err)
+	if err := wal.logWrite(file, pos, binBuf.Bytes()); err != nil {
+		return fmt.Errorf("error logging write: %w", err)
+	}
+
+	if _, err := file.Write(binBuf.Bytes()); err != nil {
+		return fmt.Errorf("error writing to file: %w", err)
 	}
 
 	return nil
 }
 
-// CompactSlaveFile handles slave file compaction.
-func CompactSlaveFile(flFile *os.File, indices []IndexTable, junk []uint32) ([]uint32, error) {
+// CompactSlaveFile handles slave file compaction. Records at the end of the file are moved into the unused slots,
+// and the links of their neighbours, or the head or the tail of the chain in their master record, are updated to follow
+// them.
+func (t *Table) CompactSlaveFile() error {
+	junk := t.Junk
 	sort.Slice(junk, func(i, j int) bool {
 		return junk[i] < junk[j]
 	})
 
-	sort.Slice(indices, func(i, j int) bool {
-		return indices[i].Address > indices[j].Address
+	moves, err := t.Entries()
+	if err != nil {
+		return err
+	}
+	sort.Slice(moves, func(i, j int) bool {
+		return moves[i].Address > moves[j].Address
 	})
 
-	var model models.Certificate
-
-	for i := 0; i < len(indices) && i < len(junk) && indices[i].Address > junk[i]; i++ {
-		err := MoveModel(flFile, &model, int64(indices[i].Address), int64(junk[i]))
+	for i := 0; i < len(moves) && i < len(junk) && moves[i].Address > junk[i]; i++ {
+		record, err := t.MoveRecord(int64(moves[i].Address), int64(junk[i]))
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		UpdateAddress(indices, indices[i].Index, junk[i])
+		if err := t.UpdateAddress(moves[i].Index, junk[i]); err != nil {
+			return err
+		}
 
-		err = updateLinkedListPointers(flFile, &model, junk[i])
+		if err := t.IndexRecord(record, junk[i]); err != nil {
+			return err
+		}
+
+		err = t.updateLinkedListPointers(record, int64(junk[i]))
 		if err != nil {
-			return nil, fmt.Errorf("error updating linked list pointers: %w", err)
+			return fmt.Errorf("error updating linked list pointers: %w", err)
 		}
 	}
 
-	err := TruncateFile(flFile, int64(len(indices)*binary.Size(model)))
+	err = TruncateFile(t.FL, int64(HeaderSize+len(moves)*t.Size))
 	if err != nil {
-		return nil, fmt.Errorf("error trancating file: %w", err)
+		return fmt.Errorf("error trancating file: %w", err)
 	}
 
-	junk = junk[:0]
+	t.Junk = junk[:0]
 
-	return junk, nil
+	return nil
 }
 
-// updateLinkedListPointers updates Next and Previous pointers of a node's neighboring nodes to its new address.
-func updateLinkedListPointers(flFile *os.File, model *models.Certificate, newAddress uint32) error {
-	// update the previous node's next pointer
-	if model.Previous != NoLink {
-		var prevModel models.Certificate
-		err := ReadModel(flFile, &prevModel, model.Previous, io.SeekStart)
+// updateLinkedListPointers updates Next and Previous pointers of a node's neighboring nodes to its new address. A
+// node without a previous or a next one is the head or the tail of its chain, so the master record is updated as
+// well, unless the node is an orphan that belongs to no chain.
+func (t *Table) updateLinkedListPointers(record *models.Record, newAddress int64) error {
+	if _, ok := t.ParentKey(record); ok && (record.Previous == NoLink || record.Next == NoLink) {
+		err := t.updateChain(record, func(chain *models.Chain) {
+			if record.Previous == NoLink {
+				chain.First = newAddress
+			}
+			if record.Next == NoLink {
+				chain.Last = newAddress
+			}
+		})
 		if err != nil {
 			return err
 		}
-		prevModel.Next = int64(newAddress)
-		err = WriteModel(flFile, &prevModel, model.Previous, io.SeekStart)
+	}
+
+	// update the previous node's next pointer
+	if record.Previous != NoLink {
+		previous, err := t.ReadRecord(record.Previous)
 		if err != nil {
 			return err
 		}
+		previous.Next = newAddress
+		if err := t.WriteRecord(record.Previous, previous); err != nil {
+			return err
+		}
 	}
 
 	// update the next node's previous pointer
-	if model.Next != NoLink {
-		var nextModel models.Certificate
-		err := ReadModel(flFile, &nextModel, model.Next, io.SeekStart)
+	if record.Next != NoLink {
+		next, err := t.ReadRecord(record.Next)
 		if err != nil {
 			return err
 		}
-		nextModel.Previous = int64(newAddress)
-		err = WriteModel(flFile, &nextModel, model.Next, io.SeekStart)
-		if err != nil {
+		next.Previous = newAddress
+		if err := t.WriteRecord(record.Next, next); err != nil {
 			return err
 		}
 	}
@@ -196,6 +442,10 @@ func updateLinkedListPointers(flFile *os.File, model *models.Certificate, newAdd
 
 // TruncateFile truncates the given file to a specific length.
 func TruncateFile(file *os.File, address int64) error {
+	if err := wal.logTruncate(file, address); err != nil {
+		return fmt.Errorf("error logging truncation: %w", err)
+	}
+
 	err := file.Truncate(address)
 	if err != nil {
 		return fmt.Errorf("error truncating file: %w", err)
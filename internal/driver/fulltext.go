@@ -0,0 +1,203 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TokenSize is the maximum size of an indexed token in bytes. Longer tokens are cut at a rune boundary.
+const TokenSize = 32
+
+// FullTextIndex is an inverted index over the words of a text field. Keys are a token followed by the record ID and
+// values are the number of times the token occurs in the field.
+type FullTextIndex struct {
+	Field  string
+	tree   *BTree
+	schema *models.Schema
+}
+
+// Match is a record found by a full-text search along with its relevance score.
+type Match struct {
+	ID      uint32
+	Address uint32
+	Score   float64
+}
+
+// OpenFullTextIndex opens the full-text index of the table on the given field, stored in the <table>.<field>.fts
+// file. If the file is new, the index is built from a scan of the .fl file.
+func (t *Table) OpenFullTextIndex(field string) error {
+	i := t.Schema.FieldIndex(field)
+	if i < 0 || !t.Schema.Fields[i].IsText() {
+		return fmt.Errorf("field %s can't be searched", field)
+	}
+	field = t.Schema.Fields[i].Name
+
+	name := fmt.Sprintf("%s.%s.fts", t.name, strings.ToLower(field))
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating %s file: %w", name, err)
+	}
+
+	if err := recoverFile(file); err != nil {
+		return fmt.Errorf("error replaying log for %s: %w", name, err)
+	}
+	wal.track(file)
+
+	empty, err := fileSize(file)
+	if err != nil {
+		return err
+	}
+
+	tree, err := OpenBTree(file, TokenSize+IndexKeySize, t.header(KindIndex, TokenSize+IndexKeySize+4))
+	if err != nil {
+		return err
+	}
+
+	index := &FullTextIndex{Field: field, tree: tree, schema: t.Schema}
+	if t.FullText == nil {
+		t.FullText = make(map[string]*FullTextIndex)
+	}
+	t.FullText[strings.ToLower(field)] = index
+
+	if empty == 0 {
+		return t.forEachRecord(index.add)
+	}
+
+	return nil
+}
+
+// Search returns the records matching any word of the query, ranked by the sum of TF-IDF weights of the matched
+// words. Records with equal scores are ordered by ID.
+func (t *Table) Search(field string, query string) ([]Match, error) {
+	index, ok := t.FullText[strings.ToLower(field)]
+	if !ok {
+		return nil, fmt.Errorf("field '%s' has no full-text index", strings.ToLower(field))
+	}
+
+	total := float64(t.NumberOfRecords())
+	scores := make(map[uint32]float64)
+
+	for token := range termFrequencies(query) {
+		prefix := tokenKey(token)
+
+		postings := make(map[uint32]uint32)
+		err := index.tree.Scan(prefix, func(key []byte, frequency uint32) bool {
+			if !bytes.HasPrefix(key, prefix) {
+				return false
+			}
+
+			postings[binary.BigEndian.Uint32(key[TokenSize:])] = frequency
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error scanning %s index: %w", index.Field, err)
+		}
+
+		idf := math.Log(1 + total/float64(max(len(postings), 1)))
+		for id, frequency := range postings {
+			scores[id] += float64(frequency) * idf
+		}
+	}
+
+	matches := make([]Match, 0, len(scores))
+	for id, score := range scores {
+		address, ok := t.GetAddressByIndex(id)
+		if !ok {
+			continue
+		}
+		matches = append(matches, Match{ID: id, Address: address, Score: score})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID < matches[j].ID
+	})
+
+	return matches, nil
+}
+
+// Tokenize splits the text into lowercase words made of letters and digits.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		tokens = append(tokens, truncateToken(strings.ToLower(word)))
+	}
+
+	return tokens
+}
+
+// add puts every token of the record's field into the index.
+func (f *FullTextIndex) add(record *models.Record, _ uint32) error {
+	for token, frequency := range termFrequencies(f.text(record)) {
+		key := append(tokenKey(token), IndexKey(record.Key())...)
+		if err := f.tree.Insert(key, frequency); err != nil {
+			return fmt.Errorf("error adding %d to %s index: %w", record.Key(), f.Field, err)
+		}
+	}
+
+	return nil
+}
+
+// remove deletes every token of the record's field from the index.
+func (f *FullTextIndex) remove(record *models.Record) error {
+	for token := range termFrequencies(f.text(record)) {
+		key := append(tokenKey(token), IndexKey(record.Key())...)
+		if _, err := f.tree.Delete(key); err != nil {
+			return fmt.Errorf("error removing %d from %s index: %w", record.Key(), f.Field, err)
+		}
+	}
+
+	return nil
+}
+
+// text returns the value of the indexed field of the record, which is empty for NULL.
+func (f *FullTextIndex) text(record *models.Record) string {
+	text, _ := record.Values[f.schema.FieldIndex(f.Field)].(string)
+	return text
+}
+
+// termFrequencies counts the occurrences of every token of the text.
+func termFrequencies(text string) map[string]uint32 {
+	frequencies := make(map[string]uint32)
+	for _, token := range Tokenize(text) {
+		frequencies[token]++
+	}
+
+	return frequencies
+}
+
+// tokenKey pads the token to TokenSize bytes.
+func tokenKey(token string) []byte {
+	key := make([]byte, TokenSize, TokenSize+IndexKeySize)
+	copy(key, token)
+
+	return key
+}
+
+// truncateToken cuts the token to at most TokenSize bytes without splitting a rune.
+func truncateToken(token string) string {
+	if len(token) <= TokenSize {
+		return token
+	}
+
+	end := TokenSize
+	for end > 0 && !utf8.RuneStart(token[end]) {
+		end--
+	}
+
+	return token[:end]
+}
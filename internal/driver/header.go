@@ -0,0 +1,157 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+)
+
+const (
+	HeaderSize    = 1024
+	FormatVersion = 1
+	MaxFields     = 32
+)
+
+// Magic identifies files created by the driver.
+var Magic = [4]byte{'D', 'B', 'M', 'S'}
+
+const (
+	KindData uint8 = iota + 1
+	KindIndex
+	KindJunk
+	KindHeap
+	KindSequence
+)
+
+// kindNames maps file kinds to the extensions of the files holding them, for error messages.
+var kindNames = map[uint8]string{
+	KindData:     ".fl",
+	KindIndex:    ".ind",
+	KindJunk:     ".jk",
+	KindHeap:     ".heap",
+	KindSequence: ".seq",
+}
+
+// LayoutField describes a single field of a model as it's encoded in the .fl file.
+type LayoutField struct {
+	Name [24]byte
+	Kind uint8
+	Size uint16
+}
+
+// FileHeader is stored at the start of every file of a table. It identifies the file and the model layout it was
+// written with, so that a file can't be silently read with a different model.
+type FileHeader struct {
+	Magic       [4]byte
+	Version     uint16
+	Kind        uint8
+	RecordSize  uint32
+	Fingerprint uint64
+	FieldCount  uint16
+	Fields      [MaxFields]LayoutField
+}
+
+// Fingerprint hashes the names, kinds and sizes of the layout fields.
+func Fingerprint(fields []LayoutField) uint64 {
+	hash := fnv.New64a()
+	for _, field := range fields {
+		_ = binary.Write(hash, binary.BigEndian, field)
+	}
+
+	return hash.Sum64()
+}
+
+// NewHeader builds the header of a file of the given kind holding records of the given size for a model with the
+// given layout.
+func NewHeader(kind uint8, recordSize int, fields []LayoutField) FileHeader {
+	header := FileHeader{
+		Magic:       Magic,
+		Version:     FormatVersion,
+		Kind:        kind,
+		RecordSize:  uint32(recordSize),
+		Fingerprint: Fingerprint(fields),
+		FieldCount:  uint16(len(fields)),
+	}
+	copy(header.Fields[:], fields)
+
+	return header
+}
+
+// Layout returns the fields described by the header.
+func (h FileHeader) Layout() []LayoutField {
+	return h.Fields[:min(int(h.FieldCount), MaxFields)]
+}
+
+// ReadHeader reads the header at the start of the file.
+func ReadHeader(file *os.File) (FileHeader, error) {
+	var header FileHeader
+
+	page := make([]byte, HeaderSize)
+	if _, err := file.ReadAt(page, 0); err != nil {
+		return header, fmt.Errorf("error reading header of %s: %w", file.Name(), err)
+	}
+
+	if err := binary.Read(bytes.NewReader(page), binary.BigEndian, &header); err != nil {
+		return header, fmt.Errorf("error decoding header of %s: %w", file.Name(), err)
+	}
+
+	return header, nil
+}
+
+// WriteHeader writes the header at the start of the file, padded to HeaderSize bytes.
+func WriteHeader(file *os.File, header FileHeader) error {
+	var binBuf bytes.Buffer
+	if err := binary.Write(&binBuf, binary.BigEndian, header); err != nil {
+		return fmt.Errorf("error encoding header: %w", err)
+	}
+
+	page := make([]byte, HeaderSize)
+	copy(page, binBuf.Bytes())
+
+	if err := writeData(file, page, 0, io.SeekStart); err != nil {
+		return fmt.Errorf("error writing header of %s: %w", file.Name(), err)
+	}
+
+	return nil
+}
+
+// checkHeader writes the expected header to an empty file or verifies the header of an existing one.
+func checkHeader(file *os.File, expected FileHeader) error {
+	size, err := fileSize(file)
+	if err != nil {
+		return err
+	}
+
+	if size == 0 {
+		return WriteHeader(file, expected)
+	}
+
+	return verifyHeader(file, expected)
+}
+
+// verifyHeader reads the header of the file and reports how it differs from the expected one.
+func verifyHeader(file *os.File, expected FileHeader) error {
+	header, err := ReadHeader(file)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case header.Magic != Magic:
+		return fmt.Errorf("%s is not a database file", file.Name())
+	case header.Version != expected.Version:
+		return fmt.Errorf("%s has format version %d, expected %d", file.Name(), header.Version, expected.Version)
+	case header.Kind != expected.Kind:
+		return fmt.Errorf("%s holds %s data, expected %s data", file.Name(),
+			kindNames[header.Kind], kindNames[expected.Kind])
+	case header.RecordSize != expected.RecordSize || header.Fingerprint != expected.Fingerprint:
+		return fmt.Errorf("%s was written with a different model layout "+
+			"(record size %d, fingerprint %016x), expected record size %d, fingerprint %016x",
+			file.Name(), header.RecordSize, header.Fingerprint, expected.RecordSize, expected.Fingerprint)
+	}
+
+	return nil
+}
@@ -0,0 +1,317 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+	"io"
+	"os"
+	"sort"
+)
+
+// HeapRefSize is the size of the reference to a heap block stored in the .fl file in place of a varchar value: the
+// offset of the block followed by the length of the value.
+const HeapRefSize = 12
+
+// heapBlock is a span of the heap file.
+type heapBlock struct {
+	offset int64
+	size   int64
+}
+
+// Heap stores the values of the varchar fields of a table in the <table>.heap file. Every value is kept in a block
+// holding its text followed by a CRC32C checksum. Blocks freed by updates and deletions are kept in a free list and
+// reused by later values, first fit, and the free list is rebuilt from the references in the .fl file whenever the
+// table is opened.
+type Heap struct {
+	file *os.File
+	free []heapBlock
+	end  int64
+	used int64
+}
+
+// OpenHeap opens the heap file holding the values of the table's varchar fields, writing its header if the file is
+// new.
+func (t *Table) OpenHeap() error {
+	name := fmt.Sprintf("%s.heap", t.name)
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating .heap file: %w", err)
+	}
+
+	if err := recoverFile(file); err != nil {
+		return fmt.Errorf("error replaying log for %s: %w", name, err)
+	}
+	wal.track(file)
+
+	// The heap doesn't depend on the layout of the records, so its header describes no fields.
+	if err := checkHeader(file, NewHeader(KindHeap, 0, nil)); err != nil {
+		return err
+	}
+
+	t.heap = &Heap{file: file}
+
+	return t.rebuildHeap()
+}
+
+// rebuildHeap reconstructs the free list of the heap from the references held by the records of the .fl file. Space
+// between referenced blocks is free, and the heap ends after the last referenced block.
+func (t *Table) rebuildHeap() error {
+	var refs []models.HeapRef
+	err := t.forEachFrame(func(_ int64, record *models.Record) error {
+		for _, ref := range record.Refs {
+			if ref.Length > 0 {
+				refs = append(refs, ref)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Offset < refs[j].Offset })
+
+	h := t.heap
+	h.free = nil
+	h.used = 0
+	position := int64(HeaderSize)
+
+	for _, ref := range refs {
+		if ref.Offset > position {
+			h.free = append(h.free, heapBlock{offset: position, size: ref.Offset - position})
+		}
+		position = max(position, ref.Offset+blockSize(ref))
+		h.used += blockSize(ref)
+	}
+	h.end = position
+
+	return nil
+}
+
+// blockSize returns the size of the heap block holding the referenced value.
+func blockSize(ref models.HeapRef) int64 {
+	return int64(ref.Length) + ChecksumSize
+}
+
+// allocate reserves a block of the given size, reusing the first free block that is large enough or growing the
+// heap otherwise.
+func (h *Heap) allocate(size int64) int64 {
+	h.used += size
+
+	for i, block := range h.free {
+		if block.size < size {
+			continue
+		}
+
+		if block.size == size {
+			h.free = append(h.free[:i], h.free[i+1:]...)
+		} else {
+			h.free[i] = heapBlock{offset: block.offset + size, size: block.size - size}
+		}
+		return block.offset
+	}
+
+	offset := h.end
+	h.end += size
+
+	return offset
+}
+
+// release returns the block of the referenced value to the free list, merging it with adjacent free blocks. Free
+// space at the end of the heap is given back, so that the next values are appended in its place.
+func (h *Heap) release(ref models.HeapRef) {
+	if ref.Length == 0 {
+		return
+	}
+
+	block := heapBlock{offset: ref.Offset, size: blockSize(ref)}
+	h.used -= block.size
+
+	i := sort.Search(len(h.free), func(i int) bool { return h.free[i].offset > block.offset })
+	h.free = append(h.free[:i], append([]heapBlock{block}, h.free[i:]...)...)
+
+	if i+1 < len(h.free) && h.free[i].offset+h.free[i].size == h.free[i+1].offset {
+		h.free[i].size += h.free[i+1].size
+		h.free = append(h.free[:i+1], h.free[i+2:]...)
+	}
+	if i > 0 && h.free[i-1].offset+h.free[i-1].size == h.free[i].offset {
+		h.free[i-1].size += h.free[i].size
+		h.free = append(h.free[:i], h.free[i+1:]...)
+		i--
+	}
+
+	if last := h.free[len(h.free)-1]; last.offset+last.size == h.end {
+		h.end = last.offset
+		h.free = h.free[:len(h.free)-1]
+	}
+}
+
+// read reads the referenced value, verifying its checksum.
+func (h *Heap) read(ref models.HeapRef) (string, error) {
+	if ref.Length == 0 {
+		return "", nil
+	}
+
+	frame := make([]byte, blockSize(ref))
+	if _, err := h.file.ReadAt(frame, ref.Offset); err != nil {
+		return "", fmt.Errorf("error reading value at offset %d of %s: %w", ref.Offset, h.file.Name(), err)
+	}
+
+	data, err := decodeFrame(h.file.Name(), ref.Offset, frame)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// write stores the value in a new block, returning its reference.
+func (h *Heap) write(value string) (models.HeapRef, error) {
+	ref := models.HeapRef{Length: uint32(len(value)), Value: value}
+	if value == "" {
+		return ref, nil
+	}
+
+	ref.Offset = h.allocate(blockSize(ref))
+	if err := writeData(h.file, encodeFrame([]byte(value)), ref.Offset, io.SeekStart); err != nil {
+		return models.HeapRef{}, fmt.Errorf("error writing value: %w", err)
+	}
+
+	return ref, nil
+}
+
+// loadValues reads the values of the varchar fields of the record from the heap.
+func (t *Table) loadValues(record *models.Record) error {
+	for i, field := range t.Schema.Fields {
+		if field.Type != models.TypeVarText || record.Values[i] == nil {
+			continue
+		}
+
+		value, err := t.heap.read(record.Refs[i])
+		if err != nil {
+			return err
+		}
+		record.Values[i] = value
+		record.Refs[i].Value = value
+	}
+
+	return nil
+}
+
+// storeValues writes the values of the varchar fields of the record that changed since it was read to new heap
+// blocks, releasing their old blocks.
+func (t *Table) storeValues(record *models.Record) error {
+	for i, field := range t.Schema.Fields {
+		value, _ := record.Values[i].(string) // NULL is stored as an empty value
+		if field.Type != models.TypeVarText || value == record.Refs[i].Value {
+			continue
+		}
+
+		t.heap.release(record.Refs[i])
+		ref, err := t.heap.write(value)
+		if err != nil {
+			return err
+		}
+		record.Refs[i] = ref
+	}
+
+	return nil
+}
+
+// releaseValues releases the heap blocks of the varchar fields of a record being deleted.
+func (t *Table) releaseValues(record *models.Record) {
+	if t.heap == nil {
+		return
+	}
+
+	for i := range record.Refs {
+		t.heap.release(record.Refs[i])
+		record.Refs[i] = models.HeapRef{}
+	}
+}
+
+// RequiresHeapCompaction reports whether more of the heap file is free than is used by values.
+func (t *Table) RequiresHeapCompaction() bool {
+	if t.heap == nil {
+		return false
+	}
+
+	free := t.heap.end - HeaderSize - t.heap.used
+	return free > 0 && free > t.heap.used
+}
+
+// CompactHeap moves the blocks of the heap file together in the order of their offsets, updating the references in
+// the records, and truncates the file after the last block.
+func (t *Table) CompactHeap() error {
+	type value struct {
+		address int64
+		record  *models.Record
+		field   int
+	}
+
+	var values []value
+	err := t.forEachFrame(func(address int64, record *models.Record) error {
+		for i, ref := range record.Refs {
+			if ref.Length > 0 {
+				values = append(values, value{address: address, record: record, field: i})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].record.Refs[values[i].field].Offset < values[j].record.Refs[values[j].field].Offset
+	})
+
+	moved := make(map[int64]*models.Record)
+	position := int64(HeaderSize)
+
+	for _, v := range values {
+		ref := &v.record.Refs[v.field]
+		block := make([]byte, blockSize(*ref))
+
+		if ref.Offset != position {
+			if _, err := t.heap.file.ReadAt(block, ref.Offset); err != nil {
+				return fmt.Errorf("error reading value at offset %d: %w", ref.Offset, err)
+			}
+			if err := writeData(t.heap.file, block, position, io.SeekStart); err != nil {
+				return fmt.Errorf("error moving value: %w", err)
+			}
+
+			ref.Offset = position
+			moved[v.address] = v.record
+		}
+
+		position += int64(len(block))
+	}
+
+	for address, record := range moved {
+		if err := t.writeFrame(address, record); err != nil {
+			return err
+		}
+	}
+
+	if err := TruncateFile(t.heap.file, position); err != nil {
+		return fmt.Errorf("error truncating heap: %w", err)
+	}
+
+	t.heap.free = nil
+	t.heap.end = position
+	t.heap.used = position - HeaderSize
+
+	return nil
+}
+
+// hasVarText reports whether the schema has varchar fields, whose values are kept in a heap file.
+func hasVarText(schema *models.Schema) bool {
+	for _, field := range schema.Fields {
+		if field.Type == models.TypeVarText {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,145 @@
+package driver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+)
+
+// IndexKeySize is the size of the primary index keys.
+const IndexKeySize = 4
+
+// IndexKey encodes the record ID as a primary index key. Big-endian encoding keeps the keys in numeric order.
+func IndexKey(id uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, id)
+}
+
+// AddIndex adds a new index and its corresponding address to the index.
+func (t *Table) AddIndex(id uint32, address uint32) error {
+	if err := t.Index.Insert(IndexKey(id), address); err != nil {
+		return fmt.Errorf("error adding index %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// RemoveIndex removes an index and its corresponding address from the index.
+func (t *Table) RemoveIndex(id uint32) error {
+	if _, err := t.Index.Delete(IndexKey(id)); err != nil {
+		return fmt.Errorf("error removing index %d: %w", id, err)
+	}
+
+	return nil
+}
+
+// UpdateAddress updates the address of the entry in the index.
+func (t *Table) UpdateAddress(id uint32, newAddress uint32) error {
+	return t.AddIndex(id, newAddress)
+}
+
+// GetAddressByIndex looks up the address associated with the specified ID in the index.
+func (t *Table) GetAddressByIndex(id uint32) (uint32, bool) {
+	address, ok, err := t.Index.Get(IndexKey(id))
+	if err != nil {
+		log.Printf("error reading index: %v\n", err)
+		return 0, false
+	}
+
+	return address, ok
+}
+
+// RecordExists checks for the existence of a record with the specified ID in the table.
+func (t *Table) RecordExists(id uint32) bool {
+	_, ok := t.GetAddressByIndex(id)
+	return ok
+}
+
+// NumberOfRecords calculates the total number of records using the index.
+func (t *Table) NumberOfRecords() int {
+	return t.Index.Len()
+}
+
+// Entries returns every index entry in ascending order of IDs.
+func (t *Table) Entries() ([]IndexTable, error) {
+	var entries []IndexTable
+
+	err := t.Index.Scan(nil, func(key []byte, address uint32) bool {
+		entries = append(entries, IndexTable{Index: binary.BigEndian.Uint32(key), Address: address})
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning index: %w", err)
+	}
+
+	return entries, nil
+}
+
+// WriteServiceData writes junk addresses to the .jk file and marks the table as cleanly closed. The index and the
+// auto-increment sequence are kept up to date on disk by every command, so they need no final write.
+func (t *Table) WriteServiceData() error {
+	return t.writeServiceData(true)
+}
+
+// writeServiceData writes the service data of the table, logging the .jk file written if verbose is set.
+func (t *Table) writeServiceData(verbose bool) error {
+	if t.withJunk {
+		jkName := fmt.Sprintf("%s.jk", t.name)
+		jkFile, err := os.OpenFile(jkName, os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			return fmt.Errorf("error creating .jk file: %w", err)
+		}
+		defer jkFile.Close()
+
+		if err := WriteHeader(jkFile, t.header(KindJunk, 4)); err != nil {
+			return err
+		}
+		if err := WriteJunk(jkFile, t.Junk); err != nil {
+			log.Println(err)
+		} else if verbose {
+			log.Printf("%s written successfully.\n", jkFile.Name())
+		}
+	}
+
+	return markClosed(t.name)
+}
+
+// Close writes the service data of the table and closes its files, along with its heap file and the files of its
+// secondary, full-text and unique indexes. The table can't be used afterwards.
+func (t *Table) Close() error {
+	return t.close(true)
+}
+
+// close closes the table, logging the service data written if verbose is set. Tables are closed quietly when they
+// are only reopened, e.g. by a DDL command.
+func (t *Table) close(verbose bool) error {
+	if err := t.writeServiceData(verbose); err != nil {
+		return err
+	}
+	wal.unregister(t)
+
+	files := []*os.File{t.FL, t.Index.file}
+	if t.heap != nil {
+		files = append(files, t.heap.file)
+	}
+	if t.seq != nil {
+		files = append(files, t.seq)
+	}
+	for _, index := range t.Secondary {
+		files = append(files, index.tree.file)
+	}
+	for _, index := range t.FullText {
+		files = append(files, index.tree.file)
+	}
+	for _, index := range t.Unique {
+		files = append(files, index.tree.file)
+	}
+
+	for _, file := range files {
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("error closing %s: %w", file.Name(), err)
+		}
+	}
+
+	return nil
+}
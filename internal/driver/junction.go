@@ -0,0 +1,42 @@
+package driver
+
+import (
+	"fmt"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+	"slices"
+	"strings"
+)
+
+// Link relates the junction table to the tables it links, so that links can be followed from either side and
+// removed along with the records they link.
+func Link(junction *Table, tables []*Table) error {
+	junction.Links = make([]*Table, len(junction.Schema.Links))
+
+	for i, link := range junction.Schema.Links {
+		j := slices.IndexFunc(tables, func(table *Table) bool { return table.Schema.Name == link.Table })
+		if j < 0 {
+			return fmt.Errorf("table %s linked by %s was not found", link.Table, junction.name)
+		}
+
+		junction.Links[i] = tables[j]
+		tables[j].Junctions = append(tables[j].Junctions, junction)
+	}
+
+	return nil
+}
+
+// LinksOf returns the IDs and addresses of the records of the junction table linking the record with the given ID
+// of the i-th linked table.
+func (t *Table) LinksOf(i int, id uint32) ([]IndexTable, error) {
+	index, ok := t.Secondary[strings.ToLower(t.Schema.Links[i].Field)]
+	if !ok {
+		return nil, fmt.Errorf("link field %s of %s is not indexed", t.Schema.Links[i].Field, t.name)
+	}
+
+	return index.Lookup(id)
+}
+
+// LinkedKey returns the key of the record of the i-th linked table that the record of the junction table links.
+func (t *Table) LinkedKey(record *models.Record, i int) uint32 {
+	return record.Values[t.Schema.FieldIndex(t.Schema.Links[i].Field)].(uint32)
+}
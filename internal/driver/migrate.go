@@ -0,0 +1,571 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// MigrationReport describes how the .fl file of a table is rewritten by a migration. Files of tables whose layouts
+// all match their schemas are left alone and reported as up to date.
+type MigrationReport struct {
+	File      string
+	UpToDate  bool
+	OldSize   int
+	NewSize   int
+	Changes   []string
+	Records   int
+	Dropped   int
+	Truncated int
+	Unlinked  int
+}
+
+// migration is the in-memory state of a table being rewritten.
+type migration struct {
+	schema  *models.Schema
+	header  FileHeader
+	layout  []LayoutField
+	records []*models.Record
+	moved   map[int64]int64
+	report  *MigrationReport
+}
+
+// Migrate rewrites the .fl files of the tables from the layout recorded in their headers to the layout of their
+// schemas. Fields are matched by name, ignoring case and underscores. Logically deleted records are left out, so
+// the heads of chains and the Previous and Next links are remapped, links to records that no longer exist are
+// cleared and the tails and lengths of chains are found again. The .ind files are rebuilt with the new addresses,
+// while the .jk files and the secondary and full-text indexes are removed to be recreated on the next start. With
+// dryRun set, only the reports are returned and no file is touched.
+func Migrate(schemas []*models.Schema, dryRun bool) ([]MigrationReport, error) {
+	migrations := make(map[string]*migration)
+	upToDate := true
+
+	for _, schema := range schemas {
+		m, err := loadMigration(schema)
+		if err != nil {
+			return nil, err
+		}
+		migrations[schema.Name] = m
+		upToDate = upToDate && m.upToDate()
+	}
+
+	if !upToDate {
+		for _, schema := range schemas {
+			migrations[schema.Name].compact()
+		}
+
+		for _, schema := range schemas {
+			migrations[schema.Name].relink(migrations)
+		}
+
+		for _, schema := range schemas {
+			migrations[schema.Name].retrace(migrations)
+		}
+	}
+
+	reports := make([]MigrationReport, 0, len(schemas))
+	for _, schema := range schemas {
+		migrations[schema.Name].report.UpToDate = upToDate
+		reports = append(reports, *migrations[schema.Name].report)
+	}
+
+	if upToDate || dryRun {
+		return reports, nil
+	}
+
+	for _, schema := range schemas {
+		if err := migrations[schema.Name].writeTemp(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, schema := range schemas {
+		if err := migrations[schema.Name].replace(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := wal.open(); err != nil {
+		return nil, err
+	}
+
+	if err := wal.file.Truncate(0); err != nil {
+		return nil, fmt.Errorf("error truncating log: %w", err)
+	}
+
+	return reports, nil
+}
+
+// loadMigration reads the header of the table's .fl file and converts its records to the layout of the schema.
+func loadMigration(schema *models.Schema) (*migration, error) {
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+
+	layout, err := SchemaLayout(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	flName := fmt.Sprintf("%s.fl", schema.Name)
+	m := &migration{
+		schema: schema,
+		layout: layout,
+		report: &MigrationReport{File: flName, NewSize: RecordSize(layout)},
+	}
+
+	fl, err := os.OpenFile(flName, os.O_RDWR, 0666)
+	if errors.Is(err, os.ErrNotExist) {
+		m.header = NewHeader(KindData, m.report.NewSize, layout)
+		m.report.OldSize = m.report.NewSize
+		return m, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", flName, err)
+	}
+	defer fl.Close()
+
+	if err := recoverFile(fl); err != nil {
+		return nil, fmt.Errorf("error replaying log for %s: %w", flName, err)
+	}
+
+	m.header, err = ReadHeader(fl)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case m.header.Magic != Magic:
+		return nil, fmt.Errorf("%s has no header, its layout is unknown", flName)
+	case m.header.Version != FormatVersion:
+		return nil, fmt.Errorf("%s has format version %d, expected %d", flName, m.header.Version, FormatVersion)
+	case m.header.Kind != KindData:
+		return nil, fmt.Errorf("%s holds %s data, expected .fl data", flName, kindNames[m.header.Kind])
+	}
+
+	m.report.OldSize = int(m.header.RecordSize)
+	m.report.Changes = layoutChanges(m.header.Layout(), layout)
+
+	frame := make([]byte, m.report.OldSize)
+	for offset := int64(HeaderSize); ; offset += int64(len(frame)) {
+		if _, err := fl.ReadAt(frame, offset); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", flName, err)
+		}
+
+		data, err := decodeFrame(flName, offset, frame)
+		if err != nil {
+			return nil, err
+		}
+
+		data, truncated, err := convertLayout(data, m.header.Layout(), layout)
+		if err != nil {
+			return nil, fmt.Errorf("error converting record at offset %d of %s: %w", offset, flName, err)
+		}
+		record := decodeRecord(schema, data)
+		clearAddedLinks(schema, record, m.header.Layout())
+		m.records = append(m.records, record)
+		m.report.Truncated += truncated
+	}
+
+	return m, nil
+}
+
+// upToDate reports whether the file already has the layout of the schema.
+func (m *migration) upToDate() bool {
+	return m.header.Fingerprint == Fingerprint(m.layout) && int(m.header.RecordSize) == m.report.NewSize
+}
+
+// compact drops logically deleted records, mapping the old addresses of the kept ones to their new addresses.
+func (m *migration) compact() {
+	m.moved = make(map[int64]int64)
+	var kept []*models.Record
+
+	for i, record := range m.records {
+		if !record.Present() {
+			m.report.Dropped++
+			continue
+		}
+
+		oldAddress := int64(HeaderSize + i*m.report.OldSize)
+		m.moved[oldAddress] = int64(HeaderSize + len(kept)*m.report.NewSize)
+		kept = append(kept, record)
+	}
+
+	m.records = kept
+	m.report.Records = len(kept)
+}
+
+// relink remaps the Previous and Next links of the records through the addresses of their own table, and the heads
+// of their chains through the addresses of the slave tables.
+func (m *migration) relink(migrations map[string]*migration) {
+	for _, record := range m.records {
+		for i, child := range m.schema.Children {
+			if slave, ok := migrations[child]; ok {
+				record.Chains[i].First = m.remap(slave.moved, record.Chains[i].First)
+			}
+		}
+
+		if m.schema.IsSlave() {
+			record.Previous = m.remap(m.moved, record.Previous)
+			record.Next = m.remap(m.moved, record.Next)
+		}
+	}
+}
+
+// retrace follows the chains of the records through the relinked records of the slave tables, pointing their tails
+// to the last records and counting them, so that files written before chains had tails and counts get them.
+func (m *migration) retrace(migrations map[string]*migration) {
+	for _, record := range m.records {
+		for i, child := range m.schema.Children {
+			slave, ok := migrations[child]
+			if !ok {
+				continue
+			}
+
+			record.Chains[i].Last = NoLink
+			record.Chains[i].Count = 0
+			visited := make(map[int64]bool)
+			for address := record.Chains[i].First; address != NoLink && !visited[address]; {
+				visited[address] = true
+				record.Chains[i].Last = address
+				record.Chains[i].Count++
+
+				j := int(address-HeaderSize) / slave.report.NewSize
+				if j < 0 || j >= len(slave.records) {
+					break
+				}
+				address = slave.records[j].Next
+			}
+		}
+	}
+}
+
+// remap returns the new address of a record, clearing links to records that were dropped.
+func (m *migration) remap(moved map[int64]int64, address int64) int64 {
+	if address == NoLink {
+		return NoLink
+	}
+
+	newAddress, ok := moved[address]
+	if !ok {
+		m.report.Unlinked++
+		return NoLink
+	}
+
+	return newAddress
+}
+
+// writeTemp writes the converted records, along with a new header, to a temporary file next to the .fl file.
+func (m *migration) writeTemp() error {
+	temp, err := os.Create(m.report.File + ".tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer temp.Close()
+
+	if err := WriteHeader(temp, NewHeader(KindData, m.report.NewSize, m.layout)); err != nil {
+		return err
+	}
+
+	for _, record := range m.records {
+		if err := writeData(temp, encodeFrame(encodeRecord(m.schema, record)), 0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+
+	return temp.Sync()
+}
+
+// replace moves the temporary file over the .fl file and rebuilds the service files of the table.
+func (m *migration) replace() error {
+	if err := os.Rename(m.report.File+".tmp", m.report.File); err != nil {
+		return fmt.Errorf("error replacing %s: %w", m.report.File, err)
+	}
+
+	derived, err := filepath.Glob(fmt.Sprintf("%s.*.ind", m.schema.Name))
+	if err != nil {
+		return err
+	}
+	fts, err := filepath.Glob(fmt.Sprintf("%s.*.fts", m.schema.Name))
+	if err != nil {
+		return err
+	}
+	derived = append(derived, fts...)
+	derived = append(derived, fmt.Sprintf("%s.jk", m.schema.Name), markerName(m.report.File))
+
+	for _, name := range derived {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing %s: %w", name, err)
+		}
+	}
+
+	indName := fmt.Sprintf("%s.ind", m.schema.Name)
+	ind, err := os.Create(indName)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", indName, err)
+	}
+	defer ind.Close()
+
+	index, err := OpenBTree(ind, IndexKeySize, NewHeader(KindIndex, IndexKeySize+4, m.layout))
+	if err != nil {
+		return err
+	}
+
+	for i, record := range m.records {
+		if err := index.Insert(IndexKey(record.Key()), uint32(HeaderSize+i*m.report.NewSize)); err != nil {
+			return fmt.Errorf("error adding index %d: %w", record.Key(), err)
+		}
+	}
+
+	return ind.Sync()
+}
+
+// clearAddedLinks clears the links of the record whose fields are missing from the old layout, e.g. the head of the
+// chain in a new slave table, which would otherwise point to offset 0.
+func clearAddedLinks(schema *models.Schema, record *models.Record, from []LayoutField) {
+	old := make(map[string]bool)
+	for _, field := range from {
+		old[layoutName(field)] = true
+	}
+	added := func(name string) bool {
+		return !old[layoutName(layoutField(name, reflect.Int64, 8))]
+	}
+
+	for i := range record.Chains {
+		if added(chainField(i)) {
+			record.Chains[i].First = NoLink
+		}
+		if added(tailField(i)) {
+			record.Chains[i].Last = NoLink
+		}
+	}
+
+	if schema.IsSlave() && added(previousField) {
+		record.Previous = NoLink
+	}
+	if schema.IsSlave() && added(nextField) {
+		record.Next = NoLink
+	}
+}
+
+// convertLayout converts the encoding of a record from one layout to another. Fields are matched by name, fields
+// missing from the old layout are left zero and fields missing from the new one are dropped. It returns the number
+// of values that had to be cut to fit a narrower field.
+func convertLayout(data []byte, from, to []LayoutField) ([]byte, int, error) {
+	old := make(map[string][]byte)
+	fields := make(map[string]LayoutField)
+	for _, field := range from {
+		name := layoutName(field)
+		old[name], data = data[:field.Size], data[field.Size:]
+		fields[name] = field
+	}
+
+	var converted []byte
+	truncated := 0
+
+	for _, field := range to {
+		if layoutName(field) == nullsField {
+			converted = append(converted, convertNulls(old[nullsField], from, to)...)
+			continue
+		}
+
+		raw, ok := old[layoutName(field)]
+		if !ok {
+			converted = append(converted, make([]byte, field.Size)...)
+			continue
+		}
+
+		value, cut, err := convertField(field, fields[layoutName(field)], raw)
+		if err != nil {
+			return nil, 0, err
+		}
+		if cut {
+			truncated++
+		}
+		converted = append(converted, value...)
+	}
+
+	return converted, truncated, nil
+}
+
+// convertNulls converts the null bitmap of a record from one layout to another, moving the bit of every field to its
+// position in the new layout. Fields missing from the old layout start as NULL, which is ignored for fields that
+// aren't nullable.
+func convertNulls(raw []byte, from, to []LayoutField) []byte {
+	known := make(map[string]bool)
+	for _, field := range from {
+		known[layoutName(field)] = true
+	}
+
+	positions := make(map[string]int)
+	for i, field := range valueFields(from) {
+		positions[layoutName(field)] = i
+	}
+
+	fields := valueFields(to)
+	nulls := make([]byte, nullsSize(len(fields)))
+	for i, field := range fields {
+		j, ok := positions[layoutName(field)]
+		if !known[layoutName(field)] || ok && raw != nil && raw[j/8]&(1<<(j%8)) != 0 {
+			nulls[i/8] |= 1 << (i % 8)
+		}
+	}
+
+	return nulls
+}
+
+// valueFields returns the fields of a layout with a null bitmap that hold values, all of which precede the bitmap.
+func valueFields(layout []LayoutField) []LayoutField {
+	for i, field := range layout {
+		if layoutName(field) == nullsField {
+			return layout[:i]
+		}
+	}
+
+	return nil
+}
+
+// convertField converts the raw encoding of a field in the old layout into its encoding in the new one. It reports
+// whether the value had to be cut to fit a narrower byte array.
+func convertField(field, old LayoutField, raw []byte) ([]byte, bool, error) {
+	kind, oldKind := reflect.Kind(field.Kind), reflect.Kind(old.Kind)
+	name := ByteArrayToString(field.Name[:])
+	value := make([]byte, field.Size)
+
+	switch {
+	case kind == reflect.Array && oldKind == reflect.Array:
+		text := ByteArrayToString(raw)
+		copy(value, models.TruncateText(text, len(value)))
+		return value, len(text) > len(value), nil
+
+	case kind == reflect.String && oldKind == reflect.String:
+		// References to heap blocks are carried over as they are, the heap file itself isn't rewritten.
+		copy(value, raw)
+		return value, false, nil
+
+	case (kind == reflect.Float64 || kind == reflect.Struct) && kind == oldKind && field.Size == old.Size:
+		copy(value, raw)
+		return value, false, nil
+
+	case kind == reflect.Bool && oldKind == reflect.Bool:
+		if raw[0] != 0 {
+			value[0] = 1
+		}
+		return value, false, nil
+
+	case isInteger(kind) && isInteger(oldKind):
+		number := decodeInteger(raw, oldKind)
+		if !fitsInteger(number, kind, len(value)) {
+			return nil, false, fmt.Errorf("value %d of %s doesn't fit %s", number, name, kind)
+		}
+		for i := len(value) - 1; i >= 0; i-- {
+			value[i] = byte(number)
+			number >>= 8
+		}
+		return value, false, nil
+	}
+
+	return nil, false, fmt.Errorf("%s can't be converted from %s to %s", name, oldKind, kind)
+}
+
+// layoutName normalizes the name of a layout field for matching, so that e.g. CourseID matches course_id.
+func layoutName(field LayoutField) string {
+	return strings.ReplaceAll(strings.ToLower(ByteArrayToString(field.Name[:])), "_", "")
+}
+
+// isInteger reports whether the kind is a fixed-size integer.
+func isInteger(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+// isSigned reports whether the kind is a signed integer.
+func isSigned(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+
+	return false
+}
+
+// decodeInteger decodes a big-endian integer of the given kind, sign-extending signed kinds.
+func decodeInteger(raw []byte, kind reflect.Kind) int64 {
+	var value uint64
+	for _, b := range raw {
+		value = value<<8 | uint64(b)
+	}
+
+	if isSigned(kind) {
+		shift := 64 - 8*len(raw)
+		return int64(value<<shift) >> shift
+	}
+
+	return int64(value)
+}
+
+// fitsInteger reports whether the value can be stored in an integer of the given kind and size.
+func fitsInteger(value int64, kind reflect.Kind, size int) bool {
+	if size >= 8 {
+		return isSigned(kind) || value >= 0
+	}
+
+	bits := 8 * size
+	if isSigned(kind) {
+		return value >= -(1<<(bits-1)) && value < 1<<(bits-1)
+	}
+
+	return value >= 0 && value < 1<<bits
+}
+
+// layoutChanges describes the differences between two layouts.
+func layoutChanges(from, to []LayoutField) []string {
+	old := make(map[string]LayoutField)
+	for _, field := range from {
+		old[layoutName(field)] = field
+	}
+
+	var changes []string
+	seen := make(map[string]bool)
+
+	for _, field := range to {
+		name := ByteArrayToString(field.Name[:])
+		seen[layoutName(field)] = true
+
+		previous, ok := old[layoutName(field)]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("%s added", name))
+		case previous.Kind != field.Kind:
+			changes = append(changes, fmt.Sprintf("%s changed from %s to %s",
+				name, reflect.Kind(previous.Kind), reflect.Kind(field.Kind)))
+		case previous.Size != field.Size:
+			changes = append(changes, fmt.Sprintf("%s resized from %d to %d bytes", name, previous.Size, field.Size))
+		case ByteArrayToString(previous.Name[:]) != name:
+			changes = append(changes, fmt.Sprintf("%s renamed to %s", ByteArrayToString(previous.Name[:]), name))
+		}
+	}
+
+	for _, field := range from {
+		if !seen[layoutName(field)] {
+			changes = append(changes, fmt.Sprintf("%s dropped", ByteArrayToString(field.Name[:])))
+		}
+	}
+
+	if len(changes) == 0 && Fingerprint(from) != Fingerprint(to) {
+		changes = append(changes, "fields reordered")
+	}
+
+	return changes
+}
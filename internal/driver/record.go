@@ -0,0 +1,388 @@
+package driver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+// secondsPerDay converts dates to the number of days since the Unix epoch they are stored as.
+const secondsPerDay = 24 * 60 * 60
+
+// Names of the service fields in the layout of a record.
+const (
+	nullsField    = "nulls"
+	previousField = "previous"
+	nextField     = "next"
+	presenceField = "presence"
+)
+
+// chainField returns the layout name of the head of the chain in the i-th slave table.
+func chainField(i int) string {
+	if i == 0 {
+		return "first_slave_address"
+	}
+
+	return fmt.Sprintf("first_slave_address_%d", i)
+}
+
+// tailField returns the layout name of the tail of the chain in the i-th slave table.
+func tailField(i int) string {
+	if i == 0 {
+		return "last_slave_address"
+	}
+
+	return fmt.Sprintf("last_slave_address_%d", i)
+}
+
+// countField returns the layout name of the number of subrecords in the chain in the i-th slave table.
+func countField(i int) string {
+	if i == 0 {
+		return "slave_count"
+	}
+
+	return fmt.Sprintf("slave_count_%d", i)
+}
+
+// SchemaLayout describes how records of the schema are encoded: its fields in order, followed by the null bitmap of a
+// table with nullable fields, the head, the tail and the length of the chain in every slave table, the Previous and
+// Next links of a slave record and the presence flag.
+func SchemaLayout(schema *models.Schema) ([]LayoutField, error) {
+	var fields []LayoutField
+
+	for _, field := range schema.Fields {
+		switch field.Type {
+		case models.TypeUint32:
+			fields = append(fields, layoutField(field.Name, reflect.Uint32, 4))
+		case models.TypeText:
+			fields = append(fields, layoutField(field.Name, reflect.Array, field.Size))
+		case models.TypeVarText:
+			fields = append(fields, layoutField(field.Name, reflect.String, HeapRefSize))
+		case models.TypeInt:
+			fields = append(fields, layoutField(field.Name, reflect.Int64, 8))
+		case models.TypeFloat:
+			fields = append(fields, layoutField(field.Name, reflect.Float64, 8))
+		case models.TypeBool:
+			fields = append(fields, layoutField(field.Name, reflect.Bool, 1))
+		case models.TypeDate:
+			// Dates are stored as the number of days since the Unix epoch.
+			fields = append(fields, layoutField(field.Name, reflect.Struct, 4))
+		case models.TypeEnum:
+			// Enum values are stored as the position of their option.
+			fields = append(fields, layoutField(field.Name, reflect.Uint8, 1))
+		default:
+			return nil, fmt.Errorf("field %s of %s has unknown %s", field.Name, schema.Name, field.Type)
+		}
+	}
+
+	if schema.HasNullable() {
+		// Bit i of the bitmap is set when the i-th field is NULL.
+		fields = append(fields, layoutField(nullsField, reflect.Slice, nullsSize(len(schema.Fields))))
+	}
+
+	for i := range schema.Children {
+		fields = append(fields, layoutField(chainField(i), reflect.Int64, 8))
+		fields = append(fields, layoutField(tailField(i), reflect.Int64, 8))
+		fields = append(fields, layoutField(countField(i), reflect.Uint32, 4))
+	}
+
+	if schema.IsSlave() {
+		fields = append(fields, layoutField(previousField, reflect.Int64, 8), layoutField(nextField, reflect.Int64, 8))
+	}
+
+	fields = append(fields, layoutField(presenceField, reflect.Bool, 1))
+
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		name := layoutName(field)
+		if seen[name] {
+			return nil, fmt.Errorf("field %s of %s clashes with another field", ByteArrayToString(field.Name[:]), schema.Name)
+		}
+		seen[name] = true
+	}
+
+	if len(fields) > MaxFields {
+		return nil, fmt.Errorf("%s has %d fields, at most %d are supported", schema.Name, len(fields), MaxFields)
+	}
+
+	return fields, nil
+}
+
+// layoutField builds the description of a field. Kinds follow reflect.Kind.
+func layoutField(name string, kind reflect.Kind, size int) LayoutField {
+	var field LayoutField
+	copy(field.Name[:], name)
+	field.Kind = uint8(kind)
+	field.Size = uint16(size)
+
+	return field
+}
+
+// nullsSize returns the size of the null bitmap of a record with the given number of fields.
+func nullsSize(fields int) int {
+	return (fields + 7) / 8
+}
+
+// RecordSize returns the size of a record's frame in the .fl file, including its checksum.
+func RecordSize(layout []LayoutField) int {
+	size := ChecksumSize
+	for _, field := range layout {
+		size += int(field.Size)
+	}
+
+	return size
+}
+
+// NewRecord returns a present record of the table with zero values and no links.
+func (t *Table) NewRecord() *models.Record {
+	record := &models.Record{
+		Values:   make([]any, len(t.Schema.Fields)),
+		Refs:     make([]models.HeapRef, len(t.Schema.Fields)),
+		Chains:   make([]models.Chain, len(t.Schema.Children)),
+		Previous: NoLink,
+		Next:     NoLink,
+		Presence: true,
+	}
+
+	for i, field := range t.Schema.Fields {
+		record.Values[i] = field.Zero()
+	}
+
+	for i := range record.Chains {
+		record.Chains[i] = models.Chain{First: NoLink, Last: NoLink}
+	}
+
+	return record
+}
+
+// ReadRecord reads the record stored at the given address, verifying its checksum, along with the values of its
+// varchar fields. A record or value whose checksum doesn't match is reported with a *CorruptionError, and io.EOF is
+// returned past the last record.
+func (t *Table) ReadRecord(address int64) (*models.Record, error) {
+	record, err := t.readFrame(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.heap != nil {
+		if err := t.loadValues(record); err != nil {
+			return nil, err
+		}
+	}
+
+	return record, nil
+}
+
+// readFrame reads the record stored at the given address without the values of its varchar fields, which are left
+// empty with their references set.
+func (t *Table) readFrame(address int64) (*models.Record, error) {
+	frame := make([]byte, t.Size)
+	n, err := t.FL.ReadAt(frame, address)
+	if err == io.EOF && n > 0 {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+
+	data, err := decodeFrame(t.FL.Name(), address, frame)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRecord(t.Schema, data), nil
+}
+
+// WriteRecord writes the record, followed by its checksum, at the given address. Values of varchar fields that
+// changed since the record was read are written to the heap first.
+func (t *Table) WriteRecord(address int64, record *models.Record) error {
+	if t.heap != nil {
+		if err := t.storeValues(record); err != nil {
+			return err
+		}
+	}
+
+	return t.writeFrame(address, record)
+}
+
+// writeFrame writes the record, followed by its checksum, at the given address, keeping the references of its
+// varchar fields as they are.
+func (t *Table) writeFrame(address int64, record *models.Record) error {
+	if err := writeData(t.FL, encodeFrame(encodeRecord(t.Schema, record)), address, io.SeekStart); err != nil {
+		return fmt.Errorf("error writing record: %w", err)
+	}
+
+	return nil
+}
+
+// MoveRecord moves the record stored at one address to another, returning it.
+func (t *Table) MoveRecord(oldAddress, newAddress int64) (*models.Record, error) {
+	record, err := t.ReadRecord(oldAddress)
+	if err != nil {
+		return nil, fmt.Errorf("error reading last record: %w", err)
+	}
+
+	if err := t.WriteRecord(newAddress, record); err != nil {
+		return nil, fmt.Errorf("error moving last record: %w", err)
+	}
+
+	return record, nil
+}
+
+// encodeRecord encodes the record in the layout of the schema.
+func encodeRecord(schema *models.Schema, record *models.Record) []byte {
+	var data []byte
+
+	for i, field := range schema.Fields {
+		if field.Type == models.TypeVarText {
+			data = binary.BigEndian.AppendUint64(data, uint64(record.Refs[i].Offset))
+			data = binary.BigEndian.AppendUint32(data, record.Refs[i].Length)
+			continue
+		}
+		data = appendValue(data, field, record.Values[i])
+	}
+
+	if schema.HasNullable() {
+		nulls := make([]byte, nullsSize(len(schema.Fields)))
+		for i, value := range record.Values {
+			if value == nil {
+				nulls[i/8] |= 1 << (i % 8)
+			}
+		}
+		data = append(data, nulls...)
+	}
+
+	for _, chain := range record.Chains {
+		data = binary.BigEndian.AppendUint64(data, uint64(chain.First))
+		data = binary.BigEndian.AppendUint64(data, uint64(chain.Last))
+		data = binary.BigEndian.AppendUint32(data, chain.Count)
+	}
+
+	if schema.IsSlave() {
+		data = binary.BigEndian.AppendUint64(data, uint64(record.Previous))
+		data = binary.BigEndian.AppendUint64(data, uint64(record.Next))
+	}
+
+	if record.Presence {
+		return append(data, 1)
+	}
+
+	return append(data, 0)
+}
+
+// appendValue appends the encoding of a field value. NULL is encoded as the zero value of the field.
+func appendValue(data []byte, field models.Field, value any) []byte {
+	if value == nil {
+		value = field.Zero()
+	}
+
+	switch field.Type {
+	case models.TypeUint32:
+		return binary.BigEndian.AppendUint32(data, value.(uint32))
+	case models.TypeInt:
+		return binary.BigEndian.AppendUint64(data, uint64(value.(int64)))
+	case models.TypeFloat:
+		return binary.BigEndian.AppendUint64(data, math.Float64bits(value.(float64)))
+	case models.TypeBool:
+		if value.(bool) {
+			return append(data, 1)
+		}
+		return append(data, 0)
+	case models.TypeDate:
+		days := value.(time.Time).Unix() / secondsPerDay
+		return binary.BigEndian.AppendUint32(data, uint32(int32(days)))
+	case models.TypeEnum:
+		return append(data, byte(field.OptionIndex(value.(string))))
+	default:
+		text := make([]byte, field.Size)
+		copy(text, value.(string))
+		return append(data, text...)
+	}
+}
+
+// decodeValue decodes a value of the field encoded by appendValue, returning it along with the number of bytes it
+// took.
+func decodeValue(field models.Field, data []byte) (any, int) {
+	switch field.Type {
+	case models.TypeUint32:
+		return binary.BigEndian.Uint32(data), 4
+	case models.TypeInt:
+		return int64(binary.BigEndian.Uint64(data)), 8
+	case models.TypeFloat:
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), 8
+	case models.TypeBool:
+		return data[0] != 0, 1
+	case models.TypeDate:
+		days := int64(int32(binary.BigEndian.Uint32(data)))
+		return time.Unix(days*secondsPerDay, 0).UTC(), 4
+	case models.TypeEnum:
+		// Positions past the options, e.g. after options were removed from the catalog, fall back to the first one.
+		i := int(data[0])
+		if i >= len(field.Options) {
+			i = 0
+		}
+		return field.Options[i], 1
+	default:
+		return ByteArrayToString(data[:field.Size]), field.Size
+	}
+}
+
+// decodeRecord decodes a record encoded in the layout of the schema.
+func decodeRecord(schema *models.Schema, data []byte) *models.Record {
+	record := &models.Record{
+		Values:   make([]any, len(schema.Fields)),
+		Refs:     make([]models.HeapRef, len(schema.Fields)),
+		Chains:   make([]models.Chain, len(schema.Children)),
+		Previous: NoLink,
+		Next:     NoLink,
+	}
+
+	for i, field := range schema.Fields {
+		switch field.Type {
+		case models.TypeVarText:
+			record.Values[i] = ""
+			record.Refs[i].Offset = int64(binary.BigEndian.Uint64(data))
+			record.Refs[i].Length = binary.BigEndian.Uint32(data[8:])
+			data = data[HeapRefSize:]
+		default:
+			value, size := decodeValue(field, data)
+			record.Values[i] = value
+			data = data[size:]
+		}
+	}
+
+	if schema.HasNullable() {
+		for i, field := range schema.Fields {
+			if field.Nullable && data[i/8]&(1<<(i%8)) != 0 {
+				record.Values[i] = nil
+			}
+		}
+		data = data[nullsSize(len(schema.Fields)):]
+	}
+
+	for i := range record.Chains {
+		record.Chains[i].First = int64(binary.BigEndian.Uint64(data))
+		record.Chains[i].Last = int64(binary.BigEndian.Uint64(data[8:]))
+		record.Chains[i].Count = binary.BigEndian.Uint32(data[16:])
+		data = data[20:]
+	}
+
+	if schema.IsSlave() {
+		record.Previous = int64(binary.BigEndian.Uint64(data))
+		record.Next = int64(binary.BigEndian.Uint64(data[8:]))
+		data = data[16:]
+	}
+
+	record.Presence = data[0] != 0
+
+	return record
+}
+
+// fieldBytes returns the encoding of the value of the named field of the record.
+func fieldBytes(schema *models.Schema, record *models.Record, name string) []byte {
+	i := schema.FieldIndex(name)
+	return appendValue(nil, schema.Fields[i], record.Values[i])
+}
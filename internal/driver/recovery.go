@@ -0,0 +1,107 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// markerName returns the name of the clean-shutdown marker of the table stored in the given .fl file. The marker
+// exists while the table is open and is removed once its service data has been written on exit.
+func markerName(flName string) string {
+	return strings.TrimSuffix(flName, ".fl") + ".dirty"
+}
+
+// wasDirty reports whether the previous session did not shut down cleanly, leaving the .jk file stale.
+func wasDirty(fl *os.File) (bool, error) {
+	_, err := os.Stat(markerName(fl.Name()))
+	if err == nil {
+		return true, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("error checking shutdown marker: %w", err)
+	}
+
+	return false, nil
+}
+
+// isMissing reports whether the .ind file is missing while the .fl file holds records.
+func isMissing(fl *os.File, ind *os.File) (bool, error) {
+	flSize, err := fileSize(fl)
+	if err != nil {
+		return false, err
+	}
+
+	indSize, err := fileSize(ind)
+	if err != nil {
+		return false, err
+	}
+
+	return flSize > HeaderSize && indSize == 0, nil
+}
+
+// markOpen creates the clean-shutdown marker of the table.
+func markOpen(fl *os.File) error {
+	marker, err := os.OpenFile(markerName(fl.Name()), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating shutdown marker: %w", err)
+	}
+
+	return marker.Close()
+}
+
+// markClosed removes the clean-shutdown marker of the table.
+func markClosed(fileName string) error {
+	err := os.Remove(markerName(fmt.Sprintf("%s.fl", fileName)))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing shutdown marker: %w", err)
+	}
+
+	return nil
+}
+
+// ScanRecords reconstructs the index table and the junk addresses by reading every record of the .fl file. Present
+// records are indexed by their key, logically deleted ones are collected as junk. Corrupted records are reported and
+// left out of both.
+func (t *Table) ScanRecords() ([]IndexTable, []uint32, error) {
+	var indices []IndexTable
+	var junk []uint32
+
+	err := t.forEachFrame(func(address int64, record *models.Record) error {
+		if record.Present() {
+			indices = append(indices, IndexTable{Index: record.Key(), Address: uint32(address)})
+		} else {
+			junk = append(junk, uint32(address))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return indices, junk, nil
+}
+
+// forEachFrame calls fn for every record of the .fl file in the order of their addresses, without reading the
+// values of their varchar fields. Corrupted records are reported and skipped.
+func (t *Table) forEachFrame(fn func(address int64, record *models.Record) error) error {
+	for address := int64(HeaderSize); ; address += int64(t.Size) {
+		record, err := t.readFrame(address)
+		var corruption *CorruptionError
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		} else if errors.As(err, &corruption) {
+			log.Println(corruption)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error reading data: %w", err)
+		}
+
+		if err := fn(address, record); err != nil {
+			return err
+		}
+	}
+}
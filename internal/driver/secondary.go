@@ -0,0 +1,174 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+	"os"
+	"strings"
+)
+
+// SecondaryIndex maps the values of a non-key text or uint32 field to the records holding them. Keys are the field
+// value followed by the record ID, so records sharing a value are adjacent in the tree, and values are record
+// addresses.
+type SecondaryIndex struct {
+	Field  string
+	tree   *BTree
+	schema *models.Schema
+	size   int
+}
+
+// OpenSecondaryIndex opens the secondary index of the table on the given field, stored in the <table>.<field>.ind
+// file. If the file is new, the index is built from a scan of the .fl file.
+func (t *Table) OpenSecondaryIndex(field string) error {
+	i := t.Schema.FieldIndex(field)
+	if i < 0 || (t.Schema.Fields[i].Type != models.TypeText && t.Schema.Fields[i].Type != models.TypeUint32) {
+		return fmt.Errorf("field %s can't be indexed", field)
+	}
+	field = t.Schema.Fields[i].Name
+	size := len(appendValue(nil, t.Schema.Fields[i], nil))
+
+	name := fmt.Sprintf("%s.%s.ind", t.name, strings.ToLower(field))
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating %s file: %w", name, err)
+	}
+
+	if err := recoverFile(file); err != nil {
+		return fmt.Errorf("error replaying log for %s: %w", name, err)
+	}
+	wal.track(file)
+
+	empty, err := fileSize(file)
+	if err != nil {
+		return err
+	}
+
+	tree, err := OpenBTree(file, size+IndexKeySize, t.header(KindIndex, size+IndexKeySize+4))
+	if err != nil {
+		return err
+	}
+
+	index := &SecondaryIndex{Field: field, tree: tree, schema: t.Schema, size: size}
+	if t.Secondary == nil {
+		t.Secondary = make(map[string]*SecondaryIndex)
+	}
+	t.Secondary[strings.ToLower(field)] = index
+
+	if empty == 0 {
+		return t.forEachRecord(index.add)
+	}
+
+	return nil
+}
+
+// forEachRecord calls fn for every record of the table in ascending order of IDs.
+func (t *Table) forEachRecord(fn func(record *models.Record, address uint32) error) error {
+	entries, err := t.Entries()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		record, err := t.ReadRecord(int64(entry.Address))
+		if err != nil {
+			return fmt.Errorf("error reading record %d: %w", entry.Index, err)
+		}
+
+		if err := fn(record, entry.Address); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IndexRecord adds the record stored at the given address to every secondary, full-text and unique index of the
+// table, or updates its address if it's already indexed.
+func (t *Table) IndexRecord(record *models.Record, address uint32) error {
+	for _, index := range t.Secondary {
+		if err := index.add(record, address); err != nil {
+			return err
+		}
+	}
+
+	for _, index := range t.FullText {
+		if err := index.add(record, address); err != nil {
+			return err
+		}
+	}
+
+	for _, index := range t.Unique {
+		if err := index.add(record, address); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnindexRecord removes the record from every secondary, full-text and unique index of the table.
+func (t *Table) UnindexRecord(record *models.Record) error {
+	for _, index := range t.Secondary {
+		if _, err := index.tree.Delete(index.key(record)); err != nil {
+			return fmt.Errorf("error removing %d from %s index: %w", record.Key(), index.Field, err)
+		}
+	}
+
+	for _, index := range t.FullText {
+		if err := index.remove(record); err != nil {
+			return err
+		}
+	}
+
+	for _, index := range t.Unique {
+		if err := index.remove(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Lookup returns the IDs and addresses of the records whose indexed field equals the value, which is of the Go type
+// of the field. NULL is never indexed, so no records hold it.
+func (s *SecondaryIndex) Lookup(value any) ([]IndexTable, error) {
+	if value == nil {
+		return nil, nil
+	}
+	prefix := appendValue(nil, s.schema.Fields[s.schema.FieldIndex(s.Field)], value)
+
+	var entries []IndexTable
+	err := s.tree.Scan(prefix, func(key []byte, address uint32) bool {
+		if !bytes.HasPrefix(key, prefix) {
+			return false
+		}
+
+		entries = append(entries, IndexTable{Index: binary.BigEndian.Uint32(key[s.size:]), Address: address})
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning %s index: %w", s.Field, err)
+	}
+
+	return entries, nil
+}
+
+// add puts the record into the index. Records whose field is NULL are left out.
+func (s *SecondaryIndex) add(record *models.Record, address uint32) error {
+	if record.Values[s.schema.FieldIndex(s.Field)] == nil {
+		return nil
+	}
+
+	if err := s.tree.Insert(s.key(record), address); err != nil {
+		return fmt.Errorf("error adding %d to %s index: %w", record.Key(), s.Field, err)
+	}
+
+	return nil
+}
+
+// key builds the index key of the record from its field value and ID.
+func (s *SecondaryIndex) key(record *models.Record) []byte {
+	return append(fieldBytes(s.schema, record, s.Field), IndexKey(record.Key())...)
+}
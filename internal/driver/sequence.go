@@ -0,0 +1,85 @@
+package driver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// sequenceName returns the name of the .seq file holding the auto-increment sequence of the table.
+func (t *Table) sequenceName() string {
+	return fmt.Sprintf("%s.seq", t.name)
+}
+
+// openSequence opens the .seq file of the table and loads the last ID handed out by its auto-increment sequence.
+// The file is written along with the records inserted, so its writes are replayed from the write-ahead log like
+// theirs. The sequence never stays behind the largest ID of the index either, so a .seq file older than the records
+// can't make IDs in use be handed out again.
+func (t *Table) openSequence() error {
+	file, err := os.OpenFile(t.sequenceName(), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating .seq file: %w", err)
+	}
+	t.seq = file
+
+	if err := recoverFile(file); err != nil {
+		return fmt.Errorf("error replaying log for %s: %w", file.Name(), err)
+	}
+	wal.track(file)
+
+	// The sequence doesn't depend on the layout of the records, so it's kept across migrations.
+	if err := checkHeader(file, NewHeader(KindSequence, 4, nil)); err != nil {
+		return err
+	}
+
+	err = readData(file, &t.sequence, HeaderSize, io.SeekStart)
+	if err != nil && err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("error reading sequence: %w", err)
+	}
+
+	last, ok, err := t.Index.Last()
+	if err != nil {
+		return fmt.Errorf("error reading index: %w", err)
+	}
+	if ok {
+		t.sequence = max(t.sequence, binary.BigEndian.Uint32(last))
+	}
+
+	return nil
+}
+
+// writeSequence writes the last ID handed out by the auto-increment sequence to the .seq file.
+func (t *Table) writeSequence() error {
+	if err := writeData(t.seq, t.sequence, HeaderSize, io.SeekStart); err != nil {
+		return fmt.Errorf("error writing sequence: %w", err)
+	}
+
+	return nil
+}
+
+// NextID returns the first ID after the auto-increment sequence of the table that isn't taken. The sequence itself
+// only moves once the ID is used, with Advance, so IDs of records that failed to be inserted are handed out again.
+func (t *Table) NextID() (uint32, error) {
+	for id := t.sequence; id < math.MaxUint32; {
+		id++
+		if !t.RecordExists(id) {
+			return id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("the IDs of %s are exhausted", t.name)
+}
+
+// Advance moves the auto-increment sequence past an ID that was used and writes it, so that the ID isn't handed out
+// again. It's called inside the transaction inserting the record, so that the two are kept or undone together.
+func (t *Table) Advance(id uint32) error {
+	if id <= t.sequence || t.seq == nil {
+		return nil
+	}
+	t.sequence = id
+
+	return t.writeSequence()
+}
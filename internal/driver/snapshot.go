@@ -0,0 +1,120 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// backupSuffix is appended to the names of the copies kept by a snapshot.
+const backupSuffix = ".bak"
+
+// Snapshot keeps copies of the files of a set of tables, taken while the tables are closed, so that the files can be
+// restored if changing them fails halfway, e.g. when a migration succeeds but the migrated tables can't be opened.
+type Snapshot struct {
+	names []string
+	files []string
+}
+
+// TakeSnapshot copies every file of the tables with the given names next to it.
+func TakeSnapshot(names []string) (*Snapshot, error) {
+	snapshot := &Snapshot{names: names}
+
+	files, err := snapshot.tableFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range files {
+		if err := copyFile(name, name+backupSuffix); err != nil {
+			return nil, errors.Join(err, snapshot.Discard())
+		}
+		snapshot.files = append(snapshot.files, name)
+	}
+
+	return snapshot, nil
+}
+
+// Restore puts the copies back in place of the files of the tables, removing the files created since the snapshot
+// was taken.
+func (s *Snapshot) Restore() error {
+	files, err := s.tableFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		if slices.Contains(s.files, name) {
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			return fmt.Errorf("error removing %s: %w", name, err)
+		}
+	}
+
+	for _, name := range s.files {
+		if err := os.Rename(name+backupSuffix, name); err != nil {
+			return fmt.Errorf("error restoring %s: %w", name, err)
+		}
+	}
+	s.files = nil
+
+	return nil
+}
+
+// Discard removes the copies once the files of the tables no longer need to be restored.
+func (s *Snapshot) Discard() error {
+	for _, name := range s.files {
+		if err := os.Remove(name + backupSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing %s: %w", name+backupSuffix, err)
+		}
+	}
+	s.files = nil
+
+	return nil
+}
+
+// tableFiles returns the names of the files of the tables, such as their .fl, .ind and .heap files and the files of
+// their indexes, leaving out the copies of a snapshot.
+func (s *Snapshot) tableFiles() ([]string, error) {
+	var files []string
+	for _, name := range s.names {
+		matches, err := filepath.Glob(name + ".*")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			if !strings.HasSuffix(match, backupSuffix) {
+				files = append(files, match)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// copyFile copies the file at src to dst, flushing the copy to disk.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", dst, err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("error copying %s: %w", src, err)
+	}
+
+	return out.Sync()
+}
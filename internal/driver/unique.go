@@ -0,0 +1,273 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// uniqueHashSize is the size of the hash of the constrained values at the start of unique index keys.
+const uniqueHashSize = 8
+
+// UniqueIndex enforces a unique constraint on one or more fields of a table. Keys are a hash of the constrained
+// values followed by the record ID, so that values of any type and length fit fixed-size keys, and values are record
+// addresses. Records sharing a hash are compared by their values, so collisions don't cause false violations.
+// Records with a NULL in any of the fields are left out, so they never conflict.
+type UniqueIndex struct {
+	Fields []string
+	tree   *BTree
+	table  *Table
+}
+
+// ConstraintError reports a record that would break a unique constraint of its table.
+type ConstraintError struct {
+	Table  string
+	Fields []string
+	Values []string
+	ID     uint32
+}
+
+// Error implements the error interface.
+func (e *ConstraintError) Error() string {
+	values := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		values[i] = fmt.Sprintf("%s '%s'", field, e.Values[i])
+	}
+
+	return fmt.Sprintf("unique constraint on %s(%s) violated: record %d already has %s",
+		e.Table, strings.Join(e.Fields, ", "), e.ID, strings.Join(values, ", "))
+}
+
+// uniqueName returns the name of the file of the unique index on the given fields of the table.
+func uniqueName(table string, fields []string) string {
+	return fmt.Sprintf("%s.%s.unique.ind", table, strings.ToLower(strings.Join(fields, "-")))
+}
+
+// OpenUniqueIndex opens the unique index of the table on the given fields, stored in the
+// <table>.<field>-<field>.unique.ind file. If the file is new, the index is built from a scan of the .fl file, and
+// the file is removed again if existing records already break the constraint.
+func (t *Table) OpenUniqueIndex(fields []string) error {
+	for _, field := range fields {
+		if t.Schema.FieldIndex(field) < 0 {
+			return fmt.Errorf("field %s of unique constraint was not found in %s", field, t.name)
+		}
+	}
+
+	name := uniqueName(t.name, fields)
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating %s file: %w", name, err)
+	}
+
+	if err := recoverFile(file); err != nil {
+		return fmt.Errorf("error replaying log for %s: %w", name, err)
+	}
+	wal.track(file)
+
+	empty, err := fileSize(file)
+	if err != nil {
+		return err
+	}
+
+	tree, err := OpenBTree(file, uniqueHashSize+IndexKeySize, t.header(KindIndex, uniqueHashSize+IndexKeySize+4))
+	if err != nil {
+		return err
+	}
+
+	index := &UniqueIndex{Fields: fields, tree: tree, table: t}
+	if empty != 0 {
+		t.Unique = append(t.Unique, index)
+		return nil
+	}
+
+	err = t.forEachRecord(func(record *models.Record, address uint32) error {
+		if err := index.check(record); err != nil {
+			return err
+		}
+		return index.add(record, address)
+	})
+	if err != nil {
+		_ = file.Close()
+		return errors.Join(err, os.Remove(name))
+	}
+
+	t.Unique = append(t.Unique, index)
+	return nil
+}
+
+// removeStaleUnique removes the files of unique indexes on constraints the schema no longer declares, so that a
+// constraint declared again later is rebuilt instead of opening an index that missed the changes made meanwhile.
+func removeStaleUnique(schema *models.Schema) error {
+	names, err := filepath.Glob(fmt.Sprintf("%s.*.unique.ind", schema.Name))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		stale := !slices.ContainsFunc(schema.Unique, func(fields []string) bool {
+			return uniqueName(schema.Name, fields) == name
+		})
+		if !stale {
+			continue
+		}
+
+		if err := os.Remove(name); err != nil {
+			return fmt.Errorf("error removing %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// CheckUnique returns a *ConstraintError if another record of the table holds the same values as the record in the
+// fields of any of its unique constraints. The record itself, identified by its ID, is skipped, so that it can be
+// checked before it's updated.
+func (t *Table) CheckUnique(record *models.Record) error {
+	for _, index := range t.Unique {
+		if err := index.check(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check returns a *ConstraintError if another record holds the same values as the record in the fields of the index.
+func (u *UniqueIndex) check(record *models.Record) error {
+	if u.hasNull(record) {
+		return nil
+	}
+
+	prefix := u.hash(record)
+	var ids []uint32
+	err := u.tree.Scan(prefix, func(key []byte, _ uint32) bool {
+		if !bytes.HasPrefix(key, prefix) {
+			return false
+		}
+
+		if id := binary.BigEndian.Uint32(key[uniqueHashSize:]); id != record.Key() {
+			ids = append(ids, id)
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("error scanning unique index: %w", err)
+	}
+
+	for _, id := range ids {
+		address, ok := u.table.GetAddressByIndex(id)
+		if !ok {
+			continue
+		}
+
+		other, err := u.table.ReadRecord(int64(address))
+		if err != nil {
+			return fmt.Errorf("error reading record %d: %w", id, err)
+		}
+
+		if u.equal(record, other) {
+			return u.violation(record, id)
+		}
+	}
+
+	return nil
+}
+
+// add puts the record into the index. Records with a NULL in any of the fields are left out.
+func (u *UniqueIndex) add(record *models.Record, address uint32) error {
+	if u.hasNull(record) {
+		return nil
+	}
+
+	if err := u.tree.Insert(u.key(record), address); err != nil {
+		return fmt.Errorf("error adding %d to unique index: %w", record.Key(), err)
+	}
+
+	return nil
+}
+
+// remove deletes the record from the index.
+func (u *UniqueIndex) remove(record *models.Record) error {
+	if u.hasNull(record) {
+		return nil
+	}
+
+	if _, err := u.tree.Delete(u.key(record)); err != nil {
+		return fmt.Errorf("error removing %d from unique index: %w", record.Key(), err)
+	}
+
+	return nil
+}
+
+// key builds the index key of the record from the hash of its values and its ID.
+func (u *UniqueIndex) key(record *models.Record) []byte {
+	return append(u.hash(record), IndexKey(record.Key())...)
+}
+
+// hash hashes the values of the fields of the index. Every value is prefixed with its length, so that e.g. "ab", "c"
+// and "a", "bc" hash differently.
+func (u *UniqueIndex) hash(record *models.Record) []byte {
+	hash := fnv.New64a()
+	schema := u.table.Schema
+
+	for _, name := range u.Fields {
+		i := schema.FieldIndex(name)
+
+		var value []byte
+		if text, ok := record.Values[i].(string); ok && schema.Fields[i].IsText() {
+			value = []byte(text)
+		} else {
+			value = appendValue(nil, schema.Fields[i], record.Values[i])
+		}
+
+		_ = binary.Write(hash, binary.BigEndian, uint32(len(value)))
+		hash.Write(value)
+	}
+
+	return hash.Sum(nil)
+}
+
+// hasNull reports whether any of the fields of the index is NULL in the record.
+func (u *UniqueIndex) hasNull(record *models.Record) bool {
+	for _, name := range u.Fields {
+		if record.Values[u.table.Schema.FieldIndex(name)] == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// equal reports whether the two records hold the same values in the fields of the index.
+func (u *UniqueIndex) equal(a, b *models.Record) bool {
+	schema := u.table.Schema
+	for _, name := range u.Fields {
+		i := schema.FieldIndex(name)
+		if b.Values[i] == nil || schema.Fields[i].Compare(a.Values[i], b.Values[i]) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// violation describes the conflict between the record and the record with the given ID.
+func (u *UniqueIndex) violation(record *models.Record, id uint32) *ConstraintError {
+	schema := u.table.Schema
+	err := &ConstraintError{Table: u.table.name, ID: id}
+
+	for _, name := range u.Fields {
+		i := schema.FieldIndex(name)
+		err.Fields = append(err.Fields, schema.Fields[i].Name)
+		err.Values = append(err.Values, schema.Fields[i].Format(record.Values[i]))
+	}
+
+	return err
+}
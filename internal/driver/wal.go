@@ -0,0 +1,402 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+)
+
+// WALName is the name of the write-ahead log shared by all tables.
+const WALName = "dbms.wal"
+
+const (
+	walWrite uint8 = iota + 1
+	walTruncate
+	walCommit
+)
+
+// walRecord is the fixed-size part of a log entry. It is followed by Name bytes of the name of the file, Before bytes
+// of the before image and After bytes of the after image.
+type walRecord struct {
+	Kind     uint8
+	TxID     uint64
+	Name     uint16
+	Offset   int64
+	FileSize int64
+	Before   uint32
+	After    uint32
+}
+
+// walEntry is a logged operation kept in memory so that the active transaction can be rolled back.
+type walEntry struct {
+	file   *os.File
+	record walRecord
+	before []byte
+}
+
+// WAL is a redo/undo write-ahead log. Every write and truncation of a tracked file made inside a transaction is
+// logged with its before and after images before the file itself is touched.
+type WAL struct {
+	file    *os.File
+	txID    uint64
+	active  bool
+	tracked map[string]bool
+	entries []walEntry
+	tables  []*Table
+}
+
+var wal = &WAL{tracked: make(map[string]bool)}
+
+// Begin starts a new transaction. All writes to tracked files are logged until Commit or Rollback is called.
+func Begin() error {
+	if wal.active {
+		return errors.New("transaction already in progress")
+	}
+
+	if err := wal.open(); err != nil {
+		return err
+	}
+
+	if err := wal.file.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating log: %w", err)
+	}
+
+	wal.txID++
+	wal.active = true
+	wal.entries = wal.entries[:0]
+
+	return nil
+}
+
+// Commit makes the active transaction durable and clears the log.
+func Commit() error {
+	if !wal.active {
+		return errors.New("no transaction in progress")
+	}
+
+	record := walRecord{Kind: walCommit, TxID: wal.txID}
+	if err := wal.append(record, "", nil, nil); err != nil {
+		return fmt.Errorf("error writing commit record: %w", err)
+	}
+
+	return wal.finish()
+}
+
+// Rollback undoes every operation of the active transaction and reloads the in-memory service data of every table
+// from the restored files. It does nothing if no transaction is in progress, so it is safe to defer right after Begin.
+func Rollback() error {
+	if !wal.active {
+		return nil
+	}
+
+	for i := len(wal.entries) - 1; i >= 0; i-- {
+		entry := wal.entries[i]
+		if err := undo(entry.file, entry.record, entry.before); err != nil {
+			return fmt.Errorf("error rolling back: %w", err)
+		}
+	}
+
+	if err := wal.finish(); err != nil {
+		return err
+	}
+
+	for _, table := range wal.tables {
+		if err := table.reload(); err != nil {
+			return fmt.Errorf("error reloading %s: %w", table.name, err)
+		}
+	}
+
+	return nil
+}
+
+// open lazily opens the log file.
+func (w *WAL) open() error {
+	if w.file != nil {
+		return nil
+	}
+
+	file, err := os.OpenFile(WALName, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("error opening log: %w", err)
+	}
+	w.file = file
+
+	return nil
+}
+
+// clear empties the log outside of a transaction, once every file it holds operations for has been recovered, so
+// that they aren't replayed again over the writes made since.
+func (w *WAL) clear() error {
+	if w.active {
+		return nil
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating log: %w", err)
+	}
+
+	return w.file.Sync()
+}
+
+// register adds the table to the ones whose service data follows transaction outcomes.
+func (w *WAL) register(table *Table) {
+	w.tables = append(w.tables, table)
+}
+
+// unregister removes the table from the ones whose service data follows transaction outcomes.
+func (w *WAL) unregister(table *Table) {
+	w.tables = slices.DeleteFunc(w.tables, func(t *Table) bool { return t == table })
+}
+
+// track marks the file as one whose writes are logged.
+func (w *WAL) track(file *os.File) {
+	w.tracked[file.Name()] = true
+}
+
+// logWrite records a write of data at the given offset of the file.
+func (w *WAL) logWrite(file *os.File, offset int64, data []byte) error {
+	if !w.active || !w.tracked[file.Name()] {
+		return nil
+	}
+
+	size, err := fileSize(file)
+	if err != nil {
+		return err
+	}
+
+	before, err := readImage(file, offset, min(int64(len(data)), size-offset))
+	if err != nil {
+		return err
+	}
+
+	record := walRecord{
+		Kind:     walWrite,
+		TxID:     w.txID,
+		Offset:   offset,
+		FileSize: size,
+	}
+
+	if err := w.append(record, file.Name(), before, data); err != nil {
+		return err
+	}
+	w.entries = append(w.entries, walEntry{file: file, record: record, before: before})
+
+	return nil
+}
+
+// logTruncate records a truncation of the file to the given size.
+func (w *WAL) logTruncate(file *os.File, newSize int64) error {
+	if !w.active || !w.tracked[file.Name()] {
+		return nil
+	}
+
+	size, err := fileSize(file)
+	if err != nil {
+		return err
+	}
+
+	before, err := readImage(file, newSize, size-newSize)
+	if err != nil {
+		return err
+	}
+
+	record := walRecord{
+		Kind:     walTruncate,
+		TxID:     w.txID,
+		Offset:   newSize,
+		FileSize: size,
+	}
+
+	if err := w.append(record, file.Name(), before, nil); err != nil {
+		return err
+	}
+	w.entries = append(w.entries, walEntry{file: file, record: record, before: before})
+
+	return nil
+}
+
+// append writes an entry for the file with the given name to the end of the log and flushes it to disk.
+func (w *WAL) append(record walRecord, name string, before, after []byte) error {
+	if len(name) > math.MaxUint16 {
+		return fmt.Errorf("file name %s is too long to be logged", name)
+	}
+
+	record.Name = uint16(len(name))
+	record.Before = uint32(len(before))
+	record.After = uint32(len(after))
+
+	var binBuf bytes.Buffer
+	if err := binary.Write(&binBuf, binary.BigEndian, record); err != nil {
+		return fmt.Errorf("error encoding log record: %w", err)
+	}
+	binBuf.WriteString(name)
+	binBuf.Write(before)
+	binBuf.Write(after)
+
+	if _, err := w.file.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("error seeking log: %w", err)
+	}
+
+	if _, err := w.file.Write(binBuf.Bytes()); err != nil {
+		return fmt.Errorf("error writing log: %w", err)
+	}
+
+	return w.file.Sync()
+}
+
+// finish flushes the files touched by the active transaction and clears the log.
+func (w *WAL) finish() error {
+	synced := make(map[*os.File]bool)
+	for _, entry := range w.entries {
+		if synced[entry.file] {
+			continue
+		}
+		if err := entry.file.Sync(); err != nil {
+			return fmt.Errorf("error flushing %s: %w", entry.file.Name(), err)
+		}
+		synced[entry.file] = true
+	}
+
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating log: %w", err)
+	}
+
+	w.active = false
+	w.entries = w.entries[:0]
+
+	return w.file.Sync()
+}
+
+// recoverFile replays the log against the given file. Operations of a committed transaction are redone, operations
+// of an unfinished one are undone in reverse order. Replay is idempotent, so the log is left in place until every
+// table has been opened and recovered, when OpenTables clears it.
+func recoverFile(file *os.File) error {
+	if err := wal.open(); err != nil {
+		return err
+	}
+
+	if _, err := wal.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking log: %w", err)
+	}
+
+	var entries []walEntry
+	var after [][]byte
+	committed := false
+
+	for {
+		var record walRecord
+		err := binary.Read(wal.file, binary.BigEndian, &record)
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error reading log: %w", err)
+		}
+
+		if record.Kind == walCommit {
+			committed = true
+			break
+		}
+
+		name := make([]byte, record.Name)
+		before := make([]byte, record.Before)
+		image := make([]byte, record.After)
+		if _, err := io.ReadFull(wal.file, name); err != nil {
+			break
+		}
+		if _, err := io.ReadFull(wal.file, before); err != nil {
+			break
+		}
+		if _, err := io.ReadFull(wal.file, image); err != nil {
+			break
+		}
+
+		if string(name) != file.Name() {
+			continue
+		}
+
+		entries = append(entries, walEntry{file: file, record: record, before: before})
+		after = append(after, image)
+	}
+
+	if committed {
+		for i, entry := range entries {
+			if err := redo(file, entry.record, after[i]); err != nil {
+				return err
+			}
+		}
+	} else {
+		for i := len(entries) - 1; i >= 0; i-- {
+			if err := undo(file, entries[i].record, entries[i].before); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(entries) > 0 {
+		return file.Sync()
+	}
+
+	return nil
+}
+
+// redo reapplies a logged operation.
+func redo(file *os.File, record walRecord, after []byte) error {
+	switch record.Kind {
+	case walWrite:
+		if _, err := file.WriteAt(after, record.Offset); err != nil {
+			return fmt.Errorf("error redoing write: %w", err)
+		}
+	case walTruncate:
+		if err := file.Truncate(record.Offset); err != nil {
+			return fmt.Errorf("error redoing truncation: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// undo restores the state of the file from before a logged operation.
+func undo(file *os.File, record walRecord, before []byte) error {
+	if _, err := file.WriteAt(before, record.Offset); err != nil {
+		return fmt.Errorf("error restoring before image: %w", err)
+	}
+
+	if err := file.Truncate(record.FileSize); err != nil {
+		return fmt.Errorf("error restoring file size: %w", err)
+	}
+
+	return nil
+}
+
+// readImage reads length bytes from the file at the given offset without moving the file offset.
+func readImage(file *os.File, offset, length int64) ([]byte, error) {
+	if length <= 0 {
+		return nil, nil
+	}
+
+	image := make([]byte, length)
+	if _, err := file.ReadAt(image, offset); err != nil {
+		return nil, fmt.Errorf("error reading before image: %w", err)
+	}
+
+	return image, nil
+}
+
+// fileSize returns the current size of the file.
+func fileSize(file *os.File) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("error reading file size: %w", err)
+	}
+
+	return info.Size(), nil
+}
@@ -0,0 +1,138 @@
+package driver
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+// useTestWAL gives the test a fresh log in a temporary working directory.
+func useTestWAL(t *testing.T) {
+	t.Helper()
+
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	wal = &WAL{tracked: make(map[string]bool)}
+	t.Cleanup(func() {
+		if wal.file != nil {
+			wal.file.Close()
+		}
+		wal = &WAL{tracked: make(map[string]bool)}
+		os.Chdir(dir)
+	})
+}
+
+// openTestFile creates a tracked file with the given contents.
+func openTestFile(t *testing.T, name string, data []byte) *os.File {
+	t.Helper()
+
+	if err := os.WriteFile(name, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.OpenFile(name, os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	wal.track(file)
+
+	return file
+}
+
+// checkFile checks that the file at the given path holds exactly the given contents.
+func checkFile(t *testing.T, name string, want []byte) {
+	t.Helper()
+
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s holds %q, want %q", name, got, want)
+	}
+}
+
+func TestRecoverCommitted(t *testing.T) {
+	useTestWAL(t)
+	file := openTestFile(t, "test.fl", []byte("aaaabbbb"))
+
+	if err := Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeData(file, []byte("cccc"), 4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeData(file, []byte("dddd"), 0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+
+	// Crash after the commit record reaches the log, but before the writes reach the file.
+	if err := wal.append(walRecord{Kind: walCommit, TxID: wal.txID}, "", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte("bbbb"), 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Truncate(8); err != nil {
+		t.Fatal(err)
+	}
+	wal.active = false
+
+	reopened := openTestFile(t, "test.fl", []byte("aaaabbbb"))
+	if err := recoverFile(reopened); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, "test.fl", []byte("aaaaccccdddd"))
+
+	// Replay is idempotent.
+	if err := recoverFile(reopened); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, "test.fl", []byte("aaaaccccdddd"))
+
+	if err := wal.clear(); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, WALName, nil)
+}
+
+func TestRecoverUncommitted(t *testing.T) {
+	useTestWAL(t)
+	file := openTestFile(t, "test.fl", []byte("aaaabbbb"))
+	other := openTestFile(t, "other.fl", []byte("xxxx"))
+
+	if err := Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeData(file, []byte("cccc"), 4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeData(other, []byte("yyyy"), 0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeData(file, []byte("dddd"), 0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+
+	// Crash before the transaction commits, with its writes already in the files.
+	wal.active = false
+
+	if err := recoverFile(file); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, "test.fl", []byte("aaaabbbb"))
+	checkFile(t, "other.fl", []byte("yyyy"))
+
+	if err := recoverFile(other); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, "other.fl", []byte("xxxx"))
+}
@@ -4,40 +4,81 @@ import (
 	"fmt"
 	"github.com/spf13/cobra"
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/driver"
-	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
-	"io"
-	"strconv"
 )
 
 // CalcMaster handles calculation and printing the number of entries in the master table.
-func (r *Repository) CalcMaster(_ *cobra.Command, _ []string) {
-	fmt.Println(driver.NumberOfRecords(r.App.Master.Indices))
+func (r *Repository) CalcMaster(cmd *cobra.Command, _ []string) {
+	master, err := r.masterTable(cmd)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(master.NumberOfRecords())
 }
 
-// CalcSlave handles calculation and printing the number of entries in the slave table.
-func (r *Repository) CalcSlave(_ *cobra.Command, args []string) {
+// CalcSlave handles calculation and printing the number of entries in the slave table, or of the subrecords of the
+// master record with the given ID, as kept in the master record.
+func (r *Repository) CalcSlave(cmd *cobra.Command, args []string) {
+	slave, err := r.slaveTable(cmd)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
 	if len(args) > 0 {
-		id, err := strconv.Atoi(args[0])
+		id, err := parseID(args[0])
 		if err != nil {
-			fmt.Printf("error parsing ID: %v\n", err)
+			fmt.Println(err)
 			return
 		}
 
-		address, ok := driver.GetAddressByIndex(r.App.Master.Indices, uint32(id))
+		address, ok := slave.Parent.GetAddressByIndex(id)
 		if !ok {
 			fmt.Printf("master record with id %v does not exist\n", id)
 			return
 		}
 
-		var course models.Course
-		err = driver.ReadModel(r.App.Master.FL, &course, int64(address), io.SeekStart)
+		master, err := slave.Parent.ReadRecord(int64(address))
 		if err != nil {
-			fmt.Printf("error reading course: %s\n", err)
+			fmt.Printf("error reading master record: %s\n", err)
 			return
 		}
 
-		fmt.Println(driver.NumberOfSubrecords(r.App.Slave.FL, course.FirstSlaveAddress))
+		fmt.Println(slave.Head(master).Count)
 	} else {
-		fmt.Println(driver.NumberOfRecords(r.App.Slave.Indices))
+		fmt.Println(slave.NumberOfRecords())
 	}
 }
+
+// Recount handles recounting the subrecords of every master record in every slave table, repairing the counts and
+// tails kept in the master records where they drifted from the chains. The number of master records repaired in each
+// table is printed.
+func (r *Repository) Recount(_ *cobra.Command, _ []string) {
+	if err := driver.Begin(); err != nil {
+		fmt.Printf("error starting transaction: %v\n", err)
+		return
+	}
+	defer driver.Rollback()
+
+	var repaired effects
+	for _, slave := range r.App.Tables {
+		if slave.Parent == nil {
+			continue
+		}
+
+		n, err := slave.Recount()
+		if err != nil {
+			fmt.Printf("error recounting %s: %v\n", slave.Schema.Name, err)
+			return
+		}
+		repaired.add("counts of "+slave.Schema.Name, slave.Parent.Schema.Name, "repaired", n)
+	}
+
+	if err := driver.Commit(); err != nil {
+		fmt.Printf("error committing transaction: %v\n", err)
+		return
+	}
+
+	repaired.print()
+}
@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/driver"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CreateTable handles declaring a new table from its name and column declarations. The key is the first column
+// unless another one is given with --key, and a slave table names its master table with --parent and the column
+// holding the master record's ID with --parent-field, while --on-delete decides what deleting a master record does to
+// its records. The table is added to the catalog and its files are created.
+func (r *Repository) CreateTable(cmd *cobra.Command, args []string) {
+	schema, err := parseSchema(cmd, args)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if driver.FindSchema(r.App.Schemas, schema.Name) != nil {
+		fmt.Printf("table %s already exists\n", schema.Name)
+		return
+	}
+
+	if _, err := os.Stat(schema.Name + ".fl"); err == nil {
+		fmt.Printf("%s.fl already exists, remove it or choose another name\n", schema.Name)
+		return
+	}
+
+	if schema.IsSlave() && driver.FindSchema(r.App.Schemas, schema.Parent) == nil {
+		fmt.Printf("the master table %s was not found\n", schema.Parent)
+		return
+	}
+
+	schemas := make([]*models.Schema, 0, len(r.App.Schemas)+1)
+	for _, existing := range r.App.Schemas {
+		if existing.Name == schema.Parent {
+			existing = existing.Clone()
+			existing.Children = append(existing.Children, schema.Name)
+		}
+		schemas = append(schemas, existing)
+	}
+	schemas = append(schemas, schema)
+
+	if _, err := r.reopen(schemas); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println("OK")
+}
+
+// AlterTable handles adding, dropping and resizing columns of a table. The .fl file of the table is rewritten in the
+// new layout with its records carried across, and the index and the links between master and slave records are
+// remapped to the new addresses.
+func (r *Repository) AlterTable(_ *cobra.Command, args []string) {
+	schema := driver.FindSchema(r.App.Schemas, args[0])
+	if schema == nil {
+		fmt.Printf("table %s was not found\n", args[0])
+		return
+	}
+
+	altered := schema.Clone()
+	if err := alterSchema(altered, args[1], args[2:]); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := altered.Validate(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if args[1] == "resize" {
+		if err := checkResize(r.App.Table(schema.Name), altered, args[2], r.App.Validation); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	schemas := make([]*models.Schema, 0, len(r.App.Schemas))
+	for _, existing := range r.App.Schemas {
+		if existing == schema {
+			existing = altered
+		}
+		schemas = append(schemas, existing)
+	}
+
+	reports, err := r.reopen(schemas)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, report := range reports {
+		if report.File == schema.Name+".fl" && !report.UpToDate {
+			printReport(report)
+		}
+	}
+
+	fmt.Println("OK")
+}
+
+// checkResize checks the records of the table against the field with the given name of the altered schema before
+// any file is rewritten. Values that no longer fit are refused in strict mode and cut in lenient mode, where records
+// whose cut values would break a unique constraint are refused as well.
+func checkResize(table *driver.Table, altered *models.Schema, name string, validation models.Validation) error {
+	i := altered.FieldIndex(name)
+	field := altered.Fields[i]
+
+	entries, err := table.Entries()
+	if err != nil {
+		return err
+	}
+
+	var records []*models.Record
+	for _, entry := range entries {
+		record, err := table.ReadRecord(int64(entry.Address))
+		if err != nil {
+			return fmt.Errorf("error reading record: %w", err)
+		}
+
+		if value, ok := record.Values[i].(string); ok && len(value) > field.Size {
+			if validation == models.Strict {
+				return fmt.Errorf("%s of record %d is %d bytes long, at most %d would fit, resizing is refused in "+
+					"strict mode", field.Name, record.Key(), len(value), field.Size)
+			}
+			record.Values[i] = models.TruncateText(value, field.Size)
+		}
+		records = append(records, record)
+	}
+
+	for _, fields := range altered.Unique {
+		if !slices.Contains(fields, field.Name) {
+			continue
+		}
+
+		seen := make(map[string]uint32)
+		for _, record := range records {
+			// As in the unique index, records with a NULL in the constraint are never duplicates.
+			values := make([]string, len(fields))
+			for j, name := range fields {
+				k := altered.FieldIndex(name)
+				values[j] = altered.Fields[k].Format(record.Values[k])
+				if record.Values[k] == nil {
+					values = nil
+					break
+				}
+			}
+			if values == nil {
+				continue
+			}
+
+			key := strings.Join(values, "\x00")
+			if other, ok := seen[key]; ok {
+				return fmt.Errorf("cutting %s to %d bytes would make records %d and %d break the unique constraint "+
+					"on %s(%s)", field.Name, field.Size, other, record.Key(), altered.Name, strings.Join(fields, ", "))
+			}
+			seen[key] = record.Key()
+		}
+	}
+
+	return nil
+}
+
+// alterSchema applies an alter-table action to the schema.
+func alterSchema(schema *models.Schema, action string, args []string) error {
+	switch {
+	case action == "add" && len(args) == 1:
+		field, err := models.ParseField(args[0])
+		if err != nil {
+			return err
+		}
+		return schema.AddField(field)
+
+	case action == "drop" && len(args) == 1:
+		return schema.DropField(args[0])
+
+	case action == "resize" && len(args) == 2:
+		size, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("error parsing size: %w", err)
+		}
+		return schema.ResizeField(args[0], size)
+
+	case action == "nullable" && len(args) == 1:
+		return schema.MakeNullable(args[0])
+
+	case action == "auto-increment" && len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+		schema.AutoIncrement = args[0] == "on"
+		return nil
+
+	case action == "unique" && len(args) == 1:
+		return schema.AddUnique(parseColumns(args[0]))
+
+	case action == "drop-unique" && len(args) == 1:
+		return schema.DropUnique(parseColumns(args[0]))
+
+	case action == "on-delete" && len(args) == 1:
+		onDelete, err := models.ParseAction(args[0])
+		if err != nil {
+			return err
+		}
+		return schema.SetOnDelete(onDelete)
+	}
+
+	return fmt.Errorf("unknown action '%s', expected add <column>:<type>, drop <column>, resize <column> <size>, "+
+		"nullable <column>, auto-increment <on|off>, unique <column>,..., drop-unique <column>,... or "+
+		"on-delete <cascade|restrict|set-null>",
+		strings.Join(append([]string{action}, args...), " "))
+}
+
+// addLinks makes the table a junction table linking the tables given as <column>:<table>. Every pair of records can be
+// linked once, and links take their IDs from an auto-increment sequence.
+func addLinks(schema *models.Schema, links []string) error {
+	if len(links) == 0 {
+		return nil
+	}
+
+	var fields []string
+	for _, spec := range links {
+		field, table, ok := strings.Cut(spec, ":")
+		if !ok || field == "" || table == "" {
+			return fmt.Errorf("invalid link %q, expected <column>:<table>", spec)
+		}
+		if err := schema.AddLink(field, table); err != nil {
+			return err
+		}
+		fields = append(fields, strings.ToLower(field))
+	}
+
+	if schema.UniqueIndex(fields) < 0 {
+		if err := schema.AddUnique(fields); err != nil {
+			return err
+		}
+	}
+	schema.AutoIncrement = true
+
+	return nil
+}
+
+// parseColumns parses a comma-separated list of column names.
+func parseColumns(arg string) []string {
+	var columns []string
+	for _, column := range strings.Split(arg, ",") {
+		columns = append(columns, strings.ToLower(strings.TrimSpace(column)))
+	}
+
+	return columns
+}
+
+// parseSchema builds the schema of a new table from the arguments and flags of create-table.
+func parseSchema(cmd *cobra.Command, args []string) (*models.Schema, error) {
+	key, _ := cmd.Flags().GetString("key")
+	parent, _ := cmd.Flags().GetString("parent")
+	parentField, _ := cmd.Flags().GetString("parent-field")
+	autoIncrement, _ := cmd.Flags().GetBool("auto-increment")
+	unique, _ := cmd.Flags().GetStringArray("unique")
+	onDelete, _ := cmd.Flags().GetString("on-delete")
+	links, _ := cmd.Flags().GetStringArray("link")
+
+	schema := &models.Schema{
+		Name:          args[0],
+		Parent:        parent,
+		ParentField:   strings.ToLower(parentField),
+		AutoIncrement: autoIncrement,
+	}
+
+	for _, spec := range args[1:] {
+		field, err := models.ParseField(spec)
+		if err != nil {
+			return nil, err
+		}
+		schema.Fields = append(schema.Fields, field)
+	}
+
+	if key != "" {
+		i := schema.FieldIndex(key)
+		if i < 0 {
+			return nil, fmt.Errorf("key column %s was not declared", key)
+		}
+		keyField := schema.Fields[i]
+		schema.Fields = slices.Insert(slices.Delete(schema.Fields, i, i+1), 0, keyField)
+	}
+
+	for _, columns := range unique {
+		if err := schema.AddUnique(parseColumns(columns)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := addLinks(schema, links); err != nil {
+		return nil, err
+	}
+
+	if (parent == "") != (parentField == "") {
+		return nil, errors.New("error: --parent and --parent-field must be given together")
+	}
+
+	if cmd.Flags().Changed("on-delete") {
+		action, err := models.ParseAction(onDelete)
+		if err != nil {
+			return nil, err
+		}
+		if err := schema.SetOnDelete(action); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+// reopen closes every table, rewrites the files whose layout no longer matches the new schemas, opens the tables of
+// the new catalog and saves it, returning the reports of the rewritten files. The files of the tables are copied
+// first, so that if any step fails they are restored and the tables of the previous catalog are opened again.
+func (r *Repository) reopen(schemas []*models.Schema) ([]driver.MigrationReport, error) {
+	if err := driver.CheckCatalog(schemas); err != nil {
+		return nil, err
+	}
+
+	if err := driver.CloseTables(r.App.Tables); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, schema := range append(slices.Clone(r.App.Schemas), schemas...) {
+		if !slices.Contains(names, schema.Name) {
+			names = append(names, schema.Name)
+		}
+	}
+
+	var reports []driver.MigrationReport
+	snapshot, err := driver.TakeSnapshot(names)
+	if err == nil {
+		err = func() error {
+			var err error
+			reports, err = driver.Migrate(schemas, false)
+			if err != nil {
+				return err
+			}
+
+			// The tables are opened before the catalog is saved, so that a catalog whose tables fail to open, e.g.
+			// over a unique constraint that existing records break, never replaces the previous one.
+			tables, err := driver.OpenTables(schemas)
+			if err != nil {
+				return err
+			}
+
+			if err := driver.SaveCatalog(schemas); err != nil {
+				return errors.Join(err, driver.CloseTables(tables))
+			}
+
+			r.App.SetTables(schemas, tables)
+			return nil
+		}()
+
+		if err == nil {
+			return reports, snapshot.Discard()
+		}
+
+		if restoreErr := snapshot.Restore(); restoreErr != nil {
+			r.App.SetTables(r.App.Schemas, nil)
+			return nil, fmt.Errorf("%w, and restoring the previous files failed: %v", err, restoreErr)
+		}
+	}
+
+	tables, reopenErr := driver.OpenTables(r.App.Schemas)
+	if reopenErr != nil {
+		r.App.SetTables(r.App.Schemas, nil)
+		return nil, fmt.Errorf("%w, and reopening the previous tables failed: %v", err, reopenErr)
+	}
+	r.App.SetTables(r.App.Schemas, tables)
+
+	return nil, err
+}
+
+// ShowTables handles printing every table of the catalog along with its relations and number of records.
+func (r *Repository) ShowTables(_ *cobra.Command, args []string) {
+	if args[0] != "tables" {
+		fmt.Printf("unknown object '%s', expected 'tables'\n", args[0])
+		return
+	}
+
+	writer := tablewriter.NewWriter(os.Stdout)
+	writer.SetHeader([]string{"TABLE", "RECORDS", "MASTER TABLE", "SLAVE TABLES"})
+	writer.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	for _, table := range r.App.Tables {
+		writer.Append([]string{
+			table.Schema.Name,
+			strconv.Itoa(table.NumberOfRecords()),
+			table.Schema.Parent,
+			strings.Join(table.Schema.Children, ", "),
+		})
+	}
+
+	writer.Render()
+}
+
+// Describe handles printing the columns of a table along with their types and attributes.
+func (r *Repository) Describe(_ *cobra.Command, args []string) {
+	schema := driver.FindSchema(r.App.Schemas, args[0])
+	if schema == nil {
+		fmt.Printf("table %s was not found\n", args[0])
+		return
+	}
+
+	writer := tablewriter.NewWriter(os.Stdout)
+	writer.SetHeader([]string{"COLUMN", "TYPE", "SIZE", "ATTRIBUTES"})
+	writer.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	for i, field := range schema.Fields {
+		size := ""
+		if field.Type == models.TypeText {
+			size = strconv.Itoa(field.Size)
+		}
+
+		writer.Append([]string{field.Name, field.TypeName(), size, strings.Join(attributes(schema, i), ", ")})
+	}
+
+	writer.Render()
+
+	if len(schema.Children) > 0 {
+		fmt.Printf("slave tables: %s\n", strings.Join(schema.Children, ", "))
+	}
+
+	var junctions []string
+	for _, other := range r.App.Schemas {
+		if other.LinkIndex(schema.Name) >= 0 {
+			junctions = append(junctions, other.Name)
+		}
+	}
+	if len(junctions) > 0 {
+		fmt.Printf("junction tables: %s\n", strings.Join(junctions, ", "))
+	}
+
+	for _, fields := range schema.Unique {
+		if len(fields) > 1 {
+			fmt.Printf("unique: (%s)\n", strings.Join(fields, ", "))
+		}
+	}
+}
+
+// attributes describes the role of the i-th field of the schema.
+func attributes(schema *models.Schema, i int) []string {
+	var attributes []string
+	name := schema.Fields[i].Name
+
+	if i == 0 {
+		attributes = append(attributes, "key")
+	}
+	if i == 0 && schema.AutoIncrement {
+		attributes = append(attributes, "auto-increment")
+	}
+	if schema.IsSlave() && strings.EqualFold(name, schema.ParentField) {
+		attributes = append(attributes, "references "+schema.Parent, "on delete "+schema.OnDelete.String())
+	}
+	if j := schema.LinkOf(name); j >= 0 {
+		attributes = append(attributes, "links "+schema.Links[j].Table)
+	}
+	if schema.Fields[i].Nullable {
+		attributes = append(attributes, "nullable")
+	}
+	if slices.ContainsFunc(schema.Unique, func(fields []string) bool {
+		return len(fields) == 1 && strings.EqualFold(fields[0], name)
+	}) {
+		attributes = append(attributes, "unique")
+	}
+	if slices.ContainsFunc(schema.Indexed, func(n string) bool { return strings.EqualFold(n, name) }) {
+		attributes = append(attributes, "indexed")
+	}
+	if slices.ContainsFunc(schema.Searchable, func(n string) bool { return strings.EqualFold(n, name) }) {
+		attributes = append(attributes, "searchable")
+	}
+
+	return attributes
+}
@@ -5,147 +5,306 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/driver"
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
-	"io"
-	"strconv"
+	"strings"
 )
 
-// DeleteMaster handles deletion of the master record by its ID.
-func (r *Repository) DeleteMaster(_ *cobra.Command, args []string) {
-	id, err := strconv.Atoi(args[0])
+// DeleteMaster handles deletion of the master record by its ID. Its subrecords in every slave table are deleted along
+// with it, kept as orphans or keep it from being deleted, as the on-delete action of the slave table says, down to
+// the slave tables of slave tables, and its links in junction tables are deleted. The number of subrecords and links
+// affected in each table is printed.
+func (r *Repository) DeleteMaster(cmd *cobra.Command, args []string) {
+	master, err := r.masterTable(cmd)
 	if err != nil {
-		fmt.Printf("error parsing ID: %v\n", err)
+		fmt.Println(err)
 		return
 	}
 
-	address, ok := driver.GetAddressByIndex(r.App.Master.Indices, uint32(id))
+	id, err := parseID(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	address, ok := master.GetAddressByIndex(id)
 	if !ok {
 		fmt.Printf("the record with ID %d was not found\n", id)
 		return
 	}
 
-	var course models.Course
-	err = driver.ReadModel(r.App.Master.FL, &course, int64(address), io.SeekStart)
+	record, err := master.ReadRecord(int64(address))
 	if err != nil {
-		fmt.Printf("error retrieving model: %s\n", err)
+		fmt.Printf("error retrieving record: %s\n", err)
 		return
 	}
 
-	if course.FirstSlaveAddress != driver.NoLink {
-		err = deleteSubrecords(r, course.FirstSlaveAddress)
-		if err != nil {
-			return
-		}
+	if err := checkRestrict(master, record); err != nil {
+		fmt.Println(err)
+		return
+	}
 
-		fmt.Println("OK")
+	if err := driver.Begin(); err != nil {
+		fmt.Printf("error starting transaction: %v\n", err)
+		return
 	}
+	defer driver.Rollback()
 
-	lastRecordAddress, ok := driver.GetLastRecordAddress(r.App.Master.Indices)
-	if !ok {
-		fmt.Printf("error getting last record address: %v\n", err)
+	var affected effects
+	if err := deleteChildren(master, record, &affected); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	if lastRecordAddress == address {
-		r.App.Master.Indices = driver.RemoveIndex(r.App.Master.Indices, uint32(id))
+	for _, junction := range master.Junctions {
+		entries, err := junction.LinksOf(junction.Schema.LinkIndex(master.Schema.Name), id)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 
-		err = driver.TruncateFile(r.App.Master.FL, int64(lastRecordAddress))
+		n, err := deleteLinks(junction, entries)
 		if err != nil {
-			fmt.Printf("error truncating file: %v\n", err)
+			fmt.Println(err)
+			return
 		}
+		affected.add("links", junction.Schema.Name, "deleted", n)
+	}
 
+	if err := master.DeleteRecord(record, int64(address)); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	var lastRecord models.Course
-	err = driver.MoveModel(r.App.Master.FL, &lastRecord, int64(lastRecordAddress), int64(address))
-	if err != nil {
-		fmt.Printf("error moving entry: %v\n", err)
+	if err := compactHeap(master); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	r.App.Master.Indices = driver.RemoveIndex(r.App.Master.Indices, uint32(id))
-	r.App.Master.Indices = driver.UpdateAddress(r.App.Master.Indices, lastRecord.ID, address)
-
-	err = driver.TruncateFile(r.App.Master.FL, int64(lastRecordAddress))
-	if err != nil {
-		fmt.Printf("error truncating file: %v\n", err)
+	if err := driver.Commit(); err != nil {
+		fmt.Printf("error committing transaction: %v\n", err)
+		return
 	}
 
-	fmt.Println("OK")
+	affected.print()
 }
 
-// DeleteSlave handles deletion of the slave record by its ID.
-func (r *Repository) DeleteSlave(_ *cobra.Command, args []string) {
-	id, err := strconv.Atoi(args[0])
+// DeleteSlave handles deletion of the slave record by its ID, unlinking it from the chain of its master record. If
+// the slave table is itself the master table of other tables, the subrecords of the record are handled as with
+// del-m.
+func (r *Repository) DeleteSlave(cmd *cobra.Command, args []string) {
+	slave, err := r.slaveTable(cmd)
 	if err != nil {
-		fmt.Printf("error parsing ID: %v\n", err)
+		fmt.Println(err)
 		return
 	}
 
-	certificateToDeleteAddress, ok := driver.GetAddressByIndex(r.App.Slave.Indices, uint32(id))
+	id, err := parseID(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	address, ok := slave.GetAddressByIndex(id)
 	if !ok {
 		fmt.Printf("the slave record with ID %d was not found\n", id)
 		return
 	}
 
-	var certificateToDelete models.Certificate
-	err = driver.ReadModel(r.App.Slave.FL, &certificateToDelete, int64(certificateToDeleteAddress), io.SeekStart)
+	record, err := slave.ReadRecord(int64(address))
 	if err != nil {
-		fmt.Printf("error reading certificate: %s\n", err)
+		fmt.Printf("error reading slave record: %s\n", err)
 		return
 	}
 
-	courseID := certificateToDelete.CourseID
+	if err := checkRestrict(slave, record); err != nil {
+		fmt.Println(err)
+		return
+	}
 
-	courseAddress, ok := driver.GetAddressByIndex(r.App.Master.Indices, courseID)
-	if !ok {
-		fmt.Printf("error reading course: %s\n", err)
+	if err := driver.Begin(); err != nil {
+		fmt.Printf("error starting transaction: %v\n", err)
 		return
 	}
+	defer driver.Rollback()
 
-	if certificateToDelete.Previous == driver.NoLink && certificateToDelete.Next != driver.NoLink {
-		err := deleteFirstNode(r, certificateToDelete, int64(courseAddress))
-		if err != nil {
-			fmt.Println(err)
+	var affected effects
+	if err := deleteChildren(slave, record, &affected); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := slave.Unlink(record); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := slave.DeleteRecord(record, int64(address)); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if slave.RequiresCompaction() {
+		if err := slave.CompactSlaveFile(); err != nil {
+			fmt.Println("error compacting file:", err)
 			return
 		}
-	} else if certificateToDelete.Previous != driver.NoLink && certificateToDelete.Next != driver.NoLink {
-		err := deleteMiddleNode(r, certificateToDelete)
-		if err != nil {
-			fmt.Println(err)
-			return
+	}
+
+	if err := compactHeap(slave); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := driver.Commit(); err != nil {
+		fmt.Printf("error committing transaction: %v\n", err)
+		return
+	}
+
+	affected.print()
+}
+
+// checkRestrict returns an error if deleting the record would take subrecords held by a slave table with the
+// restrict on-delete action, either directly or through the subrecords deleted along with it.
+func checkRestrict(table *driver.Table, record *models.Record) error {
+	for _, slave := range table.Children {
+		if slave == nil || slave.Head(record).First == driver.NoLink {
+			continue
 		}
-	} else if certificateToDelete.Previous != driver.NoLink && certificateToDelete.Next == driver.NoLink {
-		err := deleteLastNode(r, certificateToDelete)
-		if err != nil {
-			fmt.Println(err)
-			return
+
+		switch slave.Schema.OnDelete {
+		case models.Restrict:
+			// A chain that isn't empty refuses the deletion whatever its count says, which is only trusted for the
+			// message when it hasn't drifted to zero.
+			n := int(slave.Head(record).Count)
+			if n == 0 {
+				addresses, _, err := slave.Chain(slave.Head(record).First)
+				if err != nil {
+					return err
+				}
+				n = len(addresses)
+			}
+			return fmt.Errorf("%s %d has %d subrecords in %s, delete them first",
+				table.Schema.Name, record.Key(), n, slave.Schema.Name)
+
+		case models.Cascade:
+			_, records, err := slave.Chain(slave.Head(record).First)
+			if err != nil {
+				return err
+			}
+
+			for _, subrecord := range records {
+				if err := checkRestrict(slave, subrecord); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
-	certificateToDelete.Presence = false
-	certificateToDelete.Next = driver.NoLink
-	certificateToDelete.Previous = driver.NoLink
-	clear(certificateToDelete.IssuedTo[:])
+	return nil
+}
 
-	err = driver.WriteModel(r.App.Slave.FL, &certificateToDelete, int64(certificateToDeleteAddress), io.SeekStart)
-	if err != nil {
-		fmt.Printf("error updating certificateToDelete: %v\n", err)
-		return
+// deleteChildren applies the on-delete action of every slave table of the table to the subrecords of the record
+// being deleted, counting the subrecords affected. Tables restricting deletion are expected to hold no subrecords of
+// the record, as checked by checkRestrict.
+func deleteChildren(table *driver.Table, record *models.Record, affected *effects) error {
+	for _, slave := range table.Children {
+		if slave == nil || slave.Schema.OnDelete == models.Restrict || slave.Head(record).First == driver.NoLink {
+			continue
+		}
+		first := slave.Head(record).First
+
+		if slave.Schema.OnDelete == models.SetNull {
+			n, err := slave.Orphan(first)
+			if err != nil {
+				return err
+			}
+			affected.add("subrecords", slave.Schema.Name, "orphaned", n)
+			continue
+		}
+
+		if err := deleteSubrecords(slave, first, affected); err != nil {
+			return err
+		}
 	}
 
-	// update indices and junk
-	r.App.Slave.Junk = append(r.App.Slave.Junk, certificateToDeleteAddress)
-	r.App.Slave.Indices = driver.RemoveIndex(r.App.Slave.Indices, uint32(id))
+	return nil
+}
+
+// deleteSubrecords deletes every record of the chain starting at the given address in the slave table, along with
+// their own subrecords, counting the records deleted.
+func deleteSubrecords(slave *driver.Table, address int64, affected *effects) error {
+	addresses, records, err := slave.Chain(address)
+	if err != nil {
+		return fmt.Errorf("error reading slave record for deletion: %w", err)
+	}
+	affected.add("subrecords", slave.Schema.Name, "deleted", len(records))
 
-	if r.App.Slave.RequiresCompaction() {
-		updatedJunk, err := driver.CompactSlaveFile(r.App.Slave.FL, r.App.Slave.Indices, r.App.Slave.Junk)
+	for i := range records {
+		// Deleting the subrecords of a record can compact the files of the tables below it, which moves the heads of
+		// the chains held by the records of this table, so every record is read again.
+		record, err := slave.ReadRecord(addresses[i])
 		if err != nil {
-			fmt.Println("error compacting file:", err)
-			return
+			return fmt.Errorf("error reading slave record for deletion: %w", err)
+		}
+
+		if err := deleteChildren(slave, record, affected); err != nil {
+			return err
+		}
+
+		if err := slave.DeleteRecord(record, addresses[i]); err != nil {
+			return err
 		}
-		r.App.Slave.Junk = updatedJunk
 	}
 
-	fmt.Println("OK")
+	if slave.RequiresCompaction() {
+		if err := slave.CompactSlaveFile(); err != nil {
+			return fmt.Errorf("error compacting file: %w", err)
+		}
+	}
+
+	return compactHeap(slave)
+}
+
+// effect is what happened to the records of a table while a record was deleted.
+type effect struct {
+	noun    string
+	table   string
+	outcome string
+}
+
+// effects counts the records affected in every table while a record is deleted, in the order the tables were
+// reached.
+type effects struct {
+	order  []effect
+	counts map[effect]int
+}
+
+// add counts n more records of the table with the given outcome.
+func (e *effects) add(noun, table, outcome string, n int) {
+	if n == 0 {
+		return
+	}
+
+	if e.counts == nil {
+		e.counts = make(map[effect]int)
+	}
+
+	key := effect{noun: noun, table: table, outcome: outcome}
+	if _, ok := e.counts[key]; !ok {
+		e.order = append(e.order, key)
+	}
+	e.counts[key] += n
+}
+
+// print reports a successful deletion along with the records affected.
+func (e *effects) print() {
+	if len(e.order) == 0 {
+		fmt.Println("OK")
+		return
+	}
+
+	counts := make([]string, 0, len(e.order))
+	for _, key := range e.order {
+		counts = append(counts, fmt.Sprintf("%d %s in %s %s", e.counts[key], key.noun, key.table, key.outcome))
+	}
+	fmt.Printf("OK, %s\n", strings.Join(counts, ", "))
 }
@@ -5,12 +5,12 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/driver"
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
-	"io"
 	"strconv"
 	"strings"
 )
 
-// GetMaster handles printing entries from the master table based on ID and optional field names.
+// GetMaster handles printing entries from the master table based on ID and optional field names. Entries can also
+// be selected by the value of an indexed field with "by <field> <value>".
 func (r *Repository) GetMaster(cmd *cobra.Command, args []string) {
 	if len(args) == 0 {
 		fmt.Printf("error: at least 1 argument is required, got %d\n", len(args))
@@ -21,36 +21,113 @@ func (r *Repository) GetMaster(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	var offset int64
-	var all bool
+	master, err := r.masterTable(cmd)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if args[0] == "by" {
+		getMasterByIndex(cmd, master, args[1:])
+		return
+	}
+
+	var records []*models.Record
 
 	if args[0] == "all" {
-		all = true
+		records, err = readRecords(master)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 	} else {
-		id, err := strconv.Atoi(args[0])
+		id, err := parseID(args[0])
 		if err != nil {
-			fmt.Printf("error parsing ID: %v\n", err)
+			fmt.Println(err)
 			return
 		}
 
-		address, ok := driver.GetAddressByIndex(r.App.Master.Indices, uint32(id))
+		address, ok := master.GetAddressByIndex(id)
 		if !ok {
 			fmt.Printf("record with ID %d not found\n", id)
 			return
 		}
 
-		offset += int64(address)
+		records, err = readRecordsByID(master, []driver.IndexTable{{Index: id, Address: address}})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	printMasterQuery(master.Schema, records, args[1:])
+}
+
+// getMasterByIndex prints the master entries whose indexed field equals the given value, using the secondary index.
+func getMasterByIndex(cmd *cobra.Command, master *driver.Table, args []string) {
+	if len(args) < 2 {
+		fmt.Printf("error: a field name and a value are required, got %d arguments\n", len(args))
+		err := cmd.Usage()
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	index, ok := master.Secondary[strings.ToLower(args[0])]
+	if !ok {
+		fmt.Printf("field '%s' is not indexed\n", strings.ToLower(args[0]))
+		return
+	}
+
+	field := master.Schema.Fields[master.Schema.FieldIndex(args[0])]
+	value, _, err := field.Parse(args[1], models.Lenient)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	entries, err := index.Lookup(value)
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
 
-	queries := make([]string, 0, len(args)-1)
-	for _, q := range args[1:] {
-		queries = append(queries, strings.ToUpper(q))
+	if len(entries) == 0 {
+		fmt.Printf("no records with %s '%s' found\n", strings.ToLower(args[0]), args[1])
+		return
 	}
 
-	printMasterQuery(r.App.Master.FL, offset, queries, all)
+	records, err := readRecordsByID(master, entries)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	printMasterQuery(master.Schema, records, args[2:])
 }
 
-// GetSlave handles printing entries from the slave table based on ID and optional field names.
+// printMasterQuery prints the queried fields of the master records, or all of their fields without queries. The
+// records can be narrowed down with a trailing "where" clause.
+func printMasterQuery(schema *models.Schema, records []*models.Record, queries []string) {
+	queries, where, err := parseFilter(schema, queries)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	records = filterRecords(records, where)
+
+	headers := selectColumns(schema, []string{columnName(schema.Fields[0])}, queries)
+	if len(headers) == 1 && len(queries) > 0 {
+		fmt.Println("nothing to show")
+		return
+	}
+
+	printRecords(schema, records, headers)
+}
+
+// GetSlave handles printing entries from the slave table based on ID and optional field names. With "all", the
+// entries can be limited to the subrecords of a master record by passing its ID first.
 func (r *Repository) GetSlave(cmd *cobra.Command, args []string) {
 	if len(args) == 0 {
 		fmt.Printf("error: at least 1 argument is required, got %d\n", len(args))
@@ -61,74 +138,85 @@ func (r *Repository) GetSlave(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	var all = args[0] == "all"
-	id := 0
-	var err error
+	slave, err := r.slaveTable(cmd)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	queries := args[1:]
+	var records []*models.Record
 
-	if !all {
-		id, err = strconv.Atoi(args[0])
+	if args[0] != "all" {
+		id, err := parseID(args[0])
 		if err != nil {
-			fmt.Printf("error parsing ID: %v\n", err)
+			fmt.Println(err)
 			return
 		}
 
-		exists := driver.RecordExists(r.App.Slave.Indices, uint32(id))
-		if !exists {
+		address, ok := slave.GetAddressByIndex(id)
+		if !ok {
 			fmt.Printf("slave record with ID %d does not exist\n", id)
 			return
 		}
-	}
 
-	var courseID int
-	var fsAddress int64 = driver.NoLink
-	var queries []string
-	var offset int64
+		records, err = readRecordsByID(slave, []driver.IndexTable{{Index: id, Address: address}})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	} else if masterID, err := strconv.ParseUint(firstOrEmpty(queries), 10, 32); err == nil {
+		queries = queries[1:]
 
-	if len(args) > 1 {
-		queries = make([]string, 0, len(args)-1)
-		for _, q := range args[1:] {
-			queries = append(queries, strings.ToUpper(q))
+		address, ok := slave.Parent.GetAddressByIndex(uint32(masterID))
+		if !ok {
+			fmt.Printf("master record with ID %d does not exist\n", masterID)
+			return
 		}
 
-		if all {
-			courseID, err = strconv.Atoi(queries[0])
-			if err != nil {
-				courseID = driver.NoLink
-			} else {
-				exists := driver.RecordExists(r.App.Master.Indices, uint32(courseID))
-				if !exists {
-					fmt.Printf("master record with ID %d does not exist\n", courseID)
-					return
-				}
-
-				address, ok := driver.GetAddressByIndex(r.App.Master.Indices, uint32(courseID))
-				if !ok {
-					fmt.Printf("record with ID %d not found\n", courseID)
-					return
-				}
-
-				var model models.Course
-				err = driver.ReadModel(r.App.Master.FL, &model, int64(address), io.SeekStart)
-				if err != nil {
-					fmt.Printf("error reading master data: %s\n", err)
-					return
-				}
-
-				fsAddress = model.FirstSlaveAddress
-				offset = fsAddress
-			}
+		master, err := slave.Parent.ReadRecord(int64(address))
+		if err != nil {
+			fmt.Printf("error reading master data: %s\n", err)
+			return
 		}
-	}
 
-	if !all {
-		address, ok := driver.GetAddressByIndex(r.App.Slave.Indices, uint32(id))
-		if !ok {
-			fmt.Printf("error getting index of the slave record with id %d: %s\n", id, err)
+		_, records, err = slave.Chain(slave.Head(master).First)
+		if err != nil {
+			fmt.Println(err)
 			return
 		}
+	} else {
+		records, err = readRecords(slave)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 
-		offset = int64(address)
+	printSlaveQuery(slave.Schema, records, queries)
+}
+
+// printSlaveQuery prints the queried fields of the slave records along with their IDs and the IDs of their master
+// records, or all of their fields without queries. The records can be narrowed down with a trailing "where" clause.
+func printSlaveQuery(schema *models.Schema, records []*models.Record, queries []string) {
+	queries, where, err := parseFilter(schema, queries)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	records = filterRecords(records, where)
+
+	parent := schema.Fields[schema.FieldIndex(schema.ParentField)]
+	headers := selectColumns(schema, []string{columnName(schema.Fields[0]), columnName(parent)}, queries)
+
+	printRecords(schema, records, headers)
+}
+
+// firstOrEmpty returns the first argument, or an empty string if there are none.
+func firstOrEmpty(args []string) string {
+	if len(args) == 0 {
+		return ""
 	}
 
-	printSlaveQuery(r.App.Slave.FL, offset, queries, all)
+	return args[0]
 }
@@ -1,310 +1,475 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/driver"
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
 	"io"
-	"log"
 	"os"
 	"slices"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-// printMasterQuery prints selected fields from the master table based on provided field queries. If all is true,
-// all records are printed.
-func printMasterQuery(flFile *os.File, offset int64, queries []string, all bool) {
-	if all {
-		_, err := flFile.Seek(offset, io.SeekStart)
-		if err != nil {
-			return
-		}
-	} else {
-		_, err := flFile.Seek(offset, io.SeekStart)
-		if err != nil {
-			return
-		}
+// TableFlag is the name of the persistent flag selecting the table a command operates on.
+const TableFlag = "table"
+
+// masterTable returns the table given with --table, or the default master table. Slave tables are refused.
+func (r *Repository) masterTable(cmd *cobra.Command) (*driver.Table, error) {
+	table, err := r.selectTable(cmd, r.App.Master, "master")
+	if err != nil {
+		return nil, err
 	}
 
-	headers := []string{"ID"}
-
-	if len(queries) != 0 {
-		for _, query := range queries {
-
-			switch query {
-			case "ID":
-			case "TITLE":
-				headers = append(headers, "TITLE")
-			case "CATEGORY":
-				headers = append(headers, "CATEGORY")
-			case "INSTRUCTOR":
-				headers = append(headers, "INSTRUCTOR")
-			case "FS_ADDRESS":
-				headers = append(headers, "FS_ADDRESS")
-			case "PRESENCE":
-				headers = append(headers, "PRESENCE")
-			default:
-				fmt.Printf("field '%s' was not found\n", strings.ToLower(query))
-			}
+	if table.Schema.IsSlave() {
+		return nil, fmt.Errorf("%s is a slave table, use the -s commands", table.Schema.Name)
+	}
+
+	return table, nil
+}
+
+// slaveTable returns the table given with --table, or the default slave table. Only slave tables are accepted.
+func (r *Repository) slaveTable(cmd *cobra.Command) (*driver.Table, error) {
+	table, err := r.selectTable(cmd, r.App.Slave, "slave")
+	if err != nil {
+		return nil, err
+	}
+
+	if !table.Schema.IsSlave() {
+		return nil, fmt.Errorf("%s is not a slave table, use the -m commands", table.Schema.Name)
+	}
+
+	return table, nil
+}
+
+// selectTable returns the table given with --table, or the default one of the given role.
+func (r *Repository) selectTable(cmd *cobra.Command, fallback *driver.Table, role string) (*driver.Table, error) {
+	name, _ := cmd.Flags().GetString(TableFlag)
+	if name == "" {
+		if fallback == nil {
+			return nil, fmt.Errorf("there is no default %s table, use --%s to choose one", role, TableFlag)
 		}
-	} else {
-		headers = append(headers, "TITLE", "CATEGORY", "INSTRUCTOR")
+		return fallback, nil
 	}
 
-	if len(headers) == 1 && !slices.Contains(queries, "id") {
-		fmt.Println("nothing to show")
-		return
+	table := r.App.Table(name)
+	if table == nil {
+		return nil, fmt.Errorf("table %s was not found", name)
 	}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader(headers)
-	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	return table, nil
+}
+
+// skipCorrupted reports a corrupted record found while reading records, so that the caller can skip it instead of
+// printing its contents.
+func skipCorrupted(err error) bool {
+	var corruption *driver.CorruptionError
+	if !errors.As(err, &corruption) {
+		return false
+	}
+
+	fmt.Printf("skipping corrupted record: %s\n", corruption)
+	return true
+}
 
-	for {
-		var model models.Course
-		err := driver.ReadModel(flFile, &model, 0, io.SeekCurrent)
-		if err == io.EOF {
+// readRecords reads every record stored in the .fl file of the table, including logically deleted ones, in the
+// order of their addresses. Corrupted records are reported and skipped.
+func readRecords(table *driver.Table) ([]*models.Record, error) {
+	var records []*models.Record
+
+	for address := int64(driver.HeaderSize); ; address += int64(table.Size) {
+		record, err := table.ReadRecord(address)
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
 			break
+		} else if skipCorrupted(err) {
+			continue
 		} else if err != nil {
-			fmt.Printf("error reading data: %s\n", err)
-			return
+			return nil, fmt.Errorf("error reading data: %w", err)
 		}
 
-		if model.Presence == false {
-			log.Println("entry is not present...")
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// readRecordsByID reads the records stored at the addresses of the given index entries.
+func readRecordsByID(table *driver.Table, entries []driver.IndexTable) ([]*models.Record, error) {
+	records := make([]*models.Record, 0, len(entries))
+	for _, entry := range entries {
+		record, err := table.ReadRecord(int64(entry.Address))
+		if skipCorrupted(err) {
 			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading data: %w", err)
 		}
 
-		var row []string
-		for _, header := range headers {
-			switch strings.ToUpper(header) {
-			case "ID":
-				row = append(row, strconv.Itoa(int(model.ID)))
-			case "TITLE":
-				row = append(row, driver.ByteArrayToString(model.Title[:]))
-			case "CATEGORY":
-				row = append(row, driver.ByteArrayToString(model.Category[:]))
-			case "INSTRUCTOR":
-				row = append(row, driver.ByteArrayToString(model.Instructor[:]))
-			case "FS_ADDRESS":
-				row = append(row, strconv.Itoa(int(model.FirstSlaveAddress)))
-			case "PRESENCE":
-				row = append(row, strconv.FormatBool(model.Presence))
-			}
-		}
+		records = append(records, record)
+	}
 
-		table.Append(row)
-		if !all {
-			break
+	return records, nil
+}
+
+// parseRecord builds a new record of the table from one argument per field. The key of a table with an
+// auto-increment sequence can be left out, in which case it's left zero and auto is set for the caller to assign the
+// next ID of the sequence once the record is known to be valid.
+func parseRecord(table *driver.Table, args []string, validation models.Validation) (*models.Record, bool, error) {
+	fields := table.Schema.Fields
+	auto := table.Schema.AutoIncrement && len(args) == len(fields)-1
+	if auto {
+		args = append([]string{"0"}, args...)
+	}
+
+	if len(args) != len(fields) {
+		return nil, false, fmt.Errorf("error: %s takes %d values (%s), got %d",
+			table.Schema.Name, len(fields), strings.Join(fieldNames(table.Schema), ", "), len(args))
+	}
+
+	record := table.NewRecord()
+	for i, field := range fields {
+		value, err := parseValue(field, args[i], validation)
+		if err != nil {
+			return nil, false, err
 		}
+		record.Values[i] = value
 	}
 
-	table.Render()
+	return record, auto, nil
 }
 
-// printSlaveQuery prints selected fields from the slave table based on provided field queries.
-// If all is true, all records are printed. If courseIDFilter is not -1, it filters records by course ID.
-func printSlaveQuery(flFile *os.File, offset int64, queries []string, all bool) {
-	_, err := flFile.Seek(offset, io.SeekStart)
+// assignID sets the key of a new record to the next ID of the table's auto-increment sequence if it was left out.
+// The sequence is advanced past the key once the record is inserted.
+func assignID(table *driver.Table, record *models.Record, auto bool) error {
+	if !auto {
+		return nil
+	}
+
+	id, err := table.NextID()
 	if err != nil {
-		fmt.Println(0)
-		return
+		return err
 	}
+	record.Values[0] = id
 
-	headers := []string{"ID", "COURSE_ID", "ISSUED_TO"}
+	return nil
+}
 
-	courseIDFilter := driver.NoLink
-	if len(queries) > 0 && all {
-		parsedID, err := strconv.Atoi(queries[0])
-		if err == nil {
-			courseIDFilter = parsedID
-			queries = queries[1:]
-		}
+// parseValue parses the argument as a value of the field, reporting values that were cut to fit it.
+func parseValue(field models.Field, arg string, validation models.Validation) (any, error) {
+	value, truncated, err := field.Parse(arg, validation)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(queries) > 0 {
-		headers = []string{"ID", "COURSE_ID"}
-		for _, query := range queries {
-			switch strings.ToUpper(query) {
-			case "ISSUED_TO", "PREVIOUS", "NEXT", "PRESENCE":
-				headers = append(headers, query)
-			}
-		}
+	if truncated {
+		fmt.Printf("warning: value for %s was truncated to %d bytes\n", field.Name, field.Size)
 	}
 
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader(headers)
-	table.SetAlignment(tablewriter.ALIGN_LEFT)
-
-	for {
-		var model models.Certificate
-		err := driver.ReadModel(flFile, &model, 0, io.SeekCurrent)
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			fmt.Printf("error reading slave data: %s\n", err)
-			return
-		}
+	return value, nil
+}
 
-		if model.Presence == false {
-			log.Println("checking for presence...")
-			continue
-		}
+// parseID parses the key of a record.
+func parseID(arg string) (uint32, error) {
+	id, err := strconv.ParseUint(arg, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing ID: %w", err)
+	}
 
-		if courseIDFilter != driver.NoLink && int(model.CourseID) != courseIDFilter {
-			offset = model.Next
-			continue
-		}
+	return uint32(id), nil
+}
 
-		var row []string
-		for _, header := range headers {
-			switch header {
-			case "ID":
-				row = append(row, strconv.Itoa(int(model.ID)))
-			case "COURSE_ID":
-				row = append(row, strconv.Itoa(int(model.CourseID)))
-			case "ISSUED_TO":
-				row = append(row, driver.ByteArrayToString(model.IssuedTo[:]))
-			case "PREVIOUS":
-				row = append(row, strconv.Itoa(int(model.Previous)))
-			case "NEXT":
-				row = append(row, strconv.Itoa(int(model.Next)))
-			case "PRESENCE":
-				row = append(row, strconv.FormatBool(model.Presence))
-			}
-		}
+// fieldNames returns the names of the fields of the table.
+func fieldNames(schema *models.Schema) []string {
+	names := make([]string, 0, len(schema.Fields))
+	for _, field := range schema.Fields {
+		names = append(names, field.Name)
+	}
 
-		table.Append(row)
+	return names
+}
 
-		if !all {
-			break
-		}
+// columnName returns the header of the field in printed tables.
+func columnName(field models.Field) string {
+	return strings.ToUpper(field.Name)
+}
 
-		offset = model.Next
+// fieldColumns returns the headers of the fields of the table.
+func fieldColumns(schema *models.Schema) []string {
+	headers := make([]string, 0, len(schema.Fields))
+	for _, field := range schema.Fields {
+		headers = append(headers, columnName(field))
 	}
 
-	table.Render()
+	return headers
 }
 
-func deleteSubrecords(r *Repository, address int64) error {
-	for address != driver.NoLink {
-		var model models.Certificate
+// serviceColumns returns the headers of the service fields of the table.
+func serviceColumns(schema *models.Schema) []string {
+	var headers []string
+	for _, child := range schema.Children {
+		headers = append(headers, chainColumn(child), tailColumn(child), countColumn(child))
+	}
 
-		err := driver.ReadModel(r.App.Slave.FL, &model, address, io.SeekStart)
-		if err != nil {
-			return fmt.Errorf("error reading slave record for deletion: %w", err)
-		}
+	if schema.IsSlave() {
+		headers = append(headers, "PREVIOUS", "NEXT")
+	}
 
-		nextAddress := model.Next
+	return append(headers, "PRESENCE")
+}
 
-		clear(model.IssuedTo[:])
-		model.Next = driver.NoLink
-		model.Previous = driver.NoLink
-		model.Presence = false
+// chainColumn returns the header of the head of the chain in the given slave table, so that the chains of a master
+// table with several slave tables can be told apart.
+func chainColumn(child string) string {
+	return "FS_ADDRESS_" + strings.ToUpper(child)
+}
 
-		r.App.Slave.Junk = append(r.App.Slave.Junk, uint32(address))
-		r.App.Slave.Indices = driver.RemoveIndex(r.App.Slave.Indices, model.ID)
+// tailColumn returns the header of the tail of the chain in the given slave table.
+func tailColumn(child string) string {
+	return "LS_ADDRESS_" + strings.ToUpper(child)
+}
 
-		err = driver.WriteModel(r.App.Slave.FL, &model, address, io.SeekStart)
-		if err != nil {
-			return fmt.Errorf("error updating slave record to mark as deleted: %w", err)
-		}
+// countColumn returns the header of the number of subrecords in the given slave table.
+func countColumn(child string) string {
+	return "SUBRECORDS_" + strings.ToUpper(child)
+}
 
-		address = nextAddress
+// selectColumns returns the headers of the queried fields, following the fixed ones. Without queries, every field
+// of the table is selected. Unknown fields are reported and skipped.
+func selectColumns(schema *models.Schema, fixed []string, queries []string) []string {
+	headers := append([]string{}, fixed...)
+	if len(queries) == 0 {
+		for _, header := range fieldColumns(schema) {
+			if !slices.Contains(headers, header) {
+				headers = append(headers, header)
+			}
+		}
+		return headers
 	}
 
-	if r.App.Slave.RequiresCompaction() {
-		updatedJunk, err := driver.CompactSlaveFile(r.App.Slave.FL, r.App.Slave.Indices, r.App.Slave.Junk)
-		if err != nil {
-			return fmt.Errorf("error compacting file: %w", err)
+	known := append(fieldColumns(schema), serviceColumns(schema)...)
+	for _, query := range queries {
+		header := strings.ToUpper(query)
+		if !slices.Contains(known, header) {
+			fmt.Printf("field '%s' was not found\n", strings.ToLower(query))
+		} else if !slices.Contains(headers, header) {
+			headers = append(headers, header)
 		}
-		r.App.Slave.Junk = updatedJunk
 	}
 
-	return nil
+	return headers
 }
 
-// deleteFirstNode handles first node deletion.
-func deleteFirstNode(r *Repository, certificateToDelete models.Certificate, courseAddress int64) error {
-	var course models.Course
-	err := driver.ReadModel(r.App.Master.FL, &course, courseAddress, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("error reading course: %w", err)
+// operators are the comparisons accepted in "where" clauses.
+var operators = []string{"=", "!=", "<", "<=", ">", ">="}
+
+// filter selects records by comparing the value of one of their fields, as given by "where <field> <op> <value>".
+type filter struct {
+	index int
+	field models.Field
+	op    string
+	value any
+}
+
+// parseFilter splits a trailing "where <field> <op> <value>" clause off the queries. Without one, the returned filter
+// is nil and matches every record. NULL can only be compared with = and !=.
+func parseFilter(schema *models.Schema, queries []string) ([]string, *filter, error) {
+	i := slices.IndexFunc(queries, func(query string) bool { return strings.EqualFold(query, "where") })
+	if i < 0 {
+		return queries, nil, nil
 	}
 
-	course.FirstSlaveAddress = certificateToDelete.Next
+	clause := queries[i+1:]
+	if len(clause) != 3 {
+		return nil, nil, fmt.Errorf("error: where takes a field, an operator and a value, got %d arguments", len(clause))
+	}
 
-	err = driver.WriteModel(r.App.Master.FL, &course, courseAddress, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("error updating course.FirstSlaveAddress: %w", err)
+	index := schema.FieldIndex(clause[0])
+	if index < 0 {
+		return nil, nil, fmt.Errorf("field '%s' was not found", strings.ToLower(clause[0]))
 	}
 
-	var nextCertificate models.Certificate
+	if !slices.Contains(operators, clause[1]) {
+		return nil, nil, fmt.Errorf("error: unknown operator '%s', expected one of %s", clause[1],
+			strings.Join(operators, " "))
+	}
 
-	err = driver.ReadModel(r.App.Slave.FL, &nextCertificate, certificateToDelete.Next, io.SeekStart)
+	field := schema.Fields[index]
+	value, _, err := field.Parse(clause[2], models.Lenient)
 	if err != nil {
-		return fmt.Errorf("error reading nextCertificate model: %w", err)
+		return nil, nil, err
 	}
 
-	nextCertificate.Previous = driver.NoLink
+	if value == nil && clause[1] != "=" && clause[1] != "!=" {
+		return nil, nil, fmt.Errorf("error: %s can only be compared with = or !=", models.NullLiteral)
+	}
 
-	err = driver.WriteModel(r.App.Slave.FL, &nextCertificate, certificateToDelete.Next, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("error updating nextCertificate: %w", err)
+	return queries[:i], &filter{index: index, field: field, op: clause[1], value: value}, nil
+}
+
+// match reports whether the record passes the filter. Comparing NULL with a value matches nothing, while "= NULL"
+// and "!= NULL" match records whose field is and isn't NULL.
+func (f *filter) match(record *models.Record) bool {
+	if f == nil {
+		return true
 	}
 
-	return nil
+	value := record.Values[f.index]
+	if value == nil && f.value != nil {
+		return false
+	}
+
+	c := f.field.Compare(value, f.value)
+	switch f.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
 }
 
-// deleteMiddleNode handles middle node deletion.
-func deleteMiddleNode(r *Repository, certificateToDelete models.Certificate) error {
-	var previousCertificate models.Certificate
+// filterRecords returns the records that pass the filter.
+func filterRecords(records []*models.Record, f *filter) []*models.Record {
+	if f == nil {
+		return records
+	}
 
-	err := driver.ReadModel(r.App.Slave.FL, &previousCertificate, certificateToDelete.Previous, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("error reading previousCertificate: %w", err)
+	var selected []*models.Record
+	for _, record := range records {
+		if f.match(record) {
+			selected = append(selected, record)
+		}
 	}
 
-	previousCertificate.Next = certificateToDelete.Next
+	return selected
+}
 
-	err = driver.WriteModel(r.App.Slave.FL, &previousCertificate, certificateToDelete.Previous, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("error updating previousCertificate: %w", err)
+// formatRow converts the record into the cells of the given columns.
+func formatRow(schema *models.Schema, record *models.Record, headers []string) []string {
+	row := make([]string, 0, len(headers))
+	for _, header := range headers {
+		if i := schema.FieldIndex(header); i >= 0 {
+			row = append(row, schema.Fields[i].Format(record.Values[i]))
+			continue
+		}
+
+		switch header {
+		case "PREVIOUS":
+			row = append(row, strconv.FormatInt(record.Previous, 10))
+		case "NEXT":
+			row = append(row, strconv.FormatInt(record.Next, 10))
+		case "PRESENCE":
+			row = append(row, strconv.FormatBool(record.Presence))
+		default:
+			for i, child := range schema.Children {
+				if header == chainColumn(child) {
+					row = append(row, strconv.FormatInt(record.Chains[i].First, 10))
+				}
+				if header == tailColumn(child) {
+					row = append(row, strconv.FormatInt(record.Chains[i].Last, 10))
+				}
+				if header == countColumn(child) {
+					row = append(row, strconv.FormatUint(uint64(record.Chains[i].Count), 10))
+				}
+			}
+		}
 	}
 
-	var nextCertificate models.Certificate
+	return row
+}
 
-	err = driver.ReadModel(r.App.Slave.FL, &nextCertificate, certificateToDelete.Next, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("error reading nextCertificate: %w", err)
+// printRecords prints the given columns of the present records.
+func printRecords(schema *models.Schema, records []*models.Record, headers []string) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(headers)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	for _, record := range records {
+		if !record.Present() {
+			continue
+		}
+
+		table.Append(formatRow(schema, record, headers))
 	}
 
-	nextCertificate.Previous = certificateToDelete.Previous
+	table.Render()
+}
 
-	err = driver.WriteModel(r.App.Slave.FL, &nextCertificate, certificateToDelete.Next, io.SeekStart)
+// printUtilities prints every field of every record of the table, including service fields and logically deleted
+// records, ordered by ID.
+func printUtilities(table *driver.Table) {
+	records, err := readRecords(table)
 	if err != nil {
-		return fmt.Errorf("error updating nextCertificate: %w", err)
+		fmt.Println(err)
+		return
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Key() < records[j].Key() })
+
+	headers := append(fieldColumns(table.Schema), serviceColumns(table.Schema)...)
+
+	writer := tablewriter.NewWriter(os.Stdout)
+	writer.SetHeader(headers)
+	writer.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	for _, record := range records {
+		writer.Append(formatRow(table.Schema, record, headers))
+	}
+
+	writer.Render()
+}
+
+// checkLinks returns an error if a record of a junction table links a record that doesn't exist.
+func checkLinks(junction *driver.Table, record *models.Record) error {
+	for i, linked := range junction.Links {
+		if id := junction.LinkedKey(record, i); !linked.RecordExists(id) {
+			return fmt.Errorf("the record with ID %d was not found in %s", id, linked.Schema.Name)
+		}
 	}
 
 	return nil
 }
 
-// deleteLastNode handles last node deletion.
-func deleteLastNode(r *Repository, certificateToDelete models.Certificate) error {
-	var previousCertificate models.Certificate
+// deleteLinks deletes the given records of the junction table, returning the number of records deleted. Addresses
+// are looked up again before every deletion, as deleting a record moves the last one into its place.
+func deleteLinks(junction *driver.Table, entries []driver.IndexTable) (int, error) {
+	for _, entry := range entries {
+		address, ok := junction.GetAddressByIndex(entry.Index)
+		if !ok {
+			return 0, fmt.Errorf("link with ID %d was not found in %s", entry.Index, junction.Schema.Name)
+		}
+
+		record, err := junction.ReadRecord(int64(address))
+		if err != nil {
+			return 0, fmt.Errorf("error reading link: %w", err)
+		}
 
-	err := driver.ReadModel(r.App.Slave.FL, &previousCertificate, certificateToDelete.Previous, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("error reading previousCertificate: %w", err)
+		if err := junction.DeleteRecord(record, int64(address)); err != nil {
+			return 0, err
+		}
 	}
 
-	previousCertificate.Next = driver.NoLink
+	return len(entries), compactHeap(junction)
+}
 
-	err = driver.WriteModel(r.App.Slave.FL, &previousCertificate, certificateToDelete.Previous, io.SeekStart)
-	if err != nil {
-		return fmt.Errorf("error updating previousCertificate: %w", err)
+// compactHeap moves the varchar values of the table together if most of its heap file is free.
+func compactHeap(table *driver.Table) error {
+	if !table.RequiresHeapCompaction() {
+		return nil
+	}
+
+	if err := table.CompactHeap(); err != nil {
+		return fmt.Errorf("error compacting heap: %w", err)
 	}
 
 	return nil
@@ -7,142 +7,169 @@ import (
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
 	"io"
 	"log"
-	"strconv"
 )
 
 // InsertMaster handles adding entries to the master table.
-func (r *Repository) InsertMaster(_ *cobra.Command, args []string) {
-	id, err := strconv.Atoi(args[0])
+func (r *Repository) InsertMaster(cmd *cobra.Command, args []string) {
+	master, err := r.masterTable(cmd)
 	if err != nil {
-		fmt.Printf("error parsing ID: %v\n", err)
+		fmt.Println(err)
 		return
 	}
-	title, category, instructor := args[1], args[2], args[3]
 
-	indices := r.App.Master.Indices
+	record, auto, err := parseRecord(master, args, r.App.Validation)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
-	exists := driver.RecordExists(indices, uint32(id))
-	if exists {
-		fmt.Printf("record with ID %d already exists. Use update-m to update a master record\n", id)
+	insertMaster(master, record, auto)
+}
+
+// insertMaster adds the record to the end of the master table, taking its ID from the auto-increment sequence if it
+// was left out.
+func insertMaster(master *driver.Table, record *models.Record, auto bool) {
+	if !auto && master.RecordExists(record.Key()) {
+		fmt.Printf("record with ID %d already exists. Use update-m to update a master record\n", record.Key())
 		return
 	}
 
-	var course models.Course
+	if err := checkLinks(master, record); err != nil {
+		fmt.Println(err)
+		return
+	}
 
-	course.ID = uint32(id)
-	copy(course.Title[:], title)
-	copy(course.Category[:], category)
-	copy(course.Instructor[:], instructor)
-	course.FirstSlaveAddress = driver.NoLink
-	course.Presence = true
+	if err := assignID(master, record, auto); err != nil {
+		fmt.Println(err)
+		return
+	}
+	id := record.Key()
 
-	offset, _ := r.App.Master.FL.Seek(int64(len(r.App.Master.Indices)*r.App.Master.Size), io.SeekStart)
+	if err := master.CheckUnique(record); err != nil {
+		fmt.Println(err)
+		return
+	}
 
-	if err := driver.WriteModel(r.App.Master.FL, &course, offset, io.SeekStart); err != nil {
+	if err := driver.Begin(); err != nil {
+		fmt.Printf("error starting transaction: %v\n", err)
+		return
+	}
+	defer driver.Rollback()
+
+	offset := int64(driver.HeaderSize + master.NumberOfRecords()*master.Size)
+
+	if err := master.WriteRecord(offset, record); err != nil {
 		log.Println(err)
 		return
 	}
 
-	r.App.Master.Indices = driver.AddIndex(r.App.Master.Indices, uint32(id), uint32(offset))
+	if err := master.AddIndex(id, uint32(offset)); err != nil {
+		fmt.Println(err)
+		return
+	}
 
-	fmt.Println("OK")
+	if err := master.IndexRecord(record, uint32(offset)); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := master.Advance(id); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := driver.Commit(); err != nil {
+		fmt.Printf("error committing transaction: %v\n", err)
+		return
+	}
+
+	printInserted(id, auto)
 }
 
-// InsertSlave handles adding entries to the slave table.
-func (r *Repository) InsertSlave(_ *cobra.Command, args []string) {
-	id, err := strconv.Atoi(args[0])
+// InsertSlave handles adding entries to the slave table, appending them to the chain of their master record.
+func (r *Repository) InsertSlave(cmd *cobra.Command, args []string) {
+	slave, err := r.slaveTable(cmd)
 	if err != nil {
-		fmt.Printf("error parsing ID: %v\n", err)
+		fmt.Println(err)
 		return
 	}
 
-	courseID, err := strconv.Atoi(args[1])
+	record, auto, err := parseRecord(slave, args, r.App.Validation)
 	if err != nil {
-		fmt.Printf("error parsing course ID: %v\n", err)
+		fmt.Println(err)
 		return
 	}
 
-	issuedTo := args[2]
-
-	exists := driver.RecordExists(r.App.Slave.Indices, uint32(id))
-	if exists {
-		fmt.Printf("record with ID %d already exists. Use update-s to update a slave record.\n", id)
+	if !auto && slave.RecordExists(record.Key()) {
+		fmt.Printf("record with ID %d already exists. Use update-s to update a slave record.\n", record.Key())
 		return
 	}
 
-	var course models.Course
+	if parent, ok := slave.ParentKey(record); ok && !slave.Parent.RecordExists(parent) {
+		fmt.Printf("the master record with ID %d was not found\n", parent)
+		return
+	}
 
-	masterAddress, ok := driver.GetAddressByIndex(r.App.Master.Indices, uint32(courseID))
-	if !ok {
-		fmt.Printf("the master record with ID %d was not found\n", courseID)
+	if err := assignID(slave, record, auto); err != nil {
+		fmt.Println(err)
 		return
 	}
+	id := record.Key()
 
-	err = driver.ReadModel(r.App.Master.FL, &course, int64(masterAddress), io.SeekStart)
-	if err != nil {
-		fmt.Printf("error retrieving master model: %s\n", err)
+	if err := slave.CheckUnique(record); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	var newCertificate models.Certificate
-	newCertificate.ID = uint32(id)
-	newCertificate.CourseID = uint32(courseID)
-	newCertificate.Presence = true
-	copy(newCertificate.IssuedTo[:], issuedTo)
-	newCertificate.Next = driver.NoLink
-	newCertificate.Previous = driver.NoLink
+	if err := driver.Begin(); err != nil {
+		fmt.Printf("error starting transaction: %v\n", err)
+		return
+	}
+	defer driver.Rollback()
 
 	var offset int64
-	if len(r.App.Slave.Junk) > 0 {
-		offset = int64(r.App.Slave.Junk[0])
-		r.App.Slave.Junk = r.App.Slave.Junk[1:]
+	if len(slave.Junk) > 0 {
+		offset = int64(slave.Junk[0])
+		slave.Junk = slave.Junk[1:]
 	} else {
-		offset, _ = r.App.Slave.FL.Seek(0, io.SeekEnd)
+		offset, _ = slave.FL.Seek(0, io.SeekEnd)
 	}
 
-	if course.FirstSlaveAddress == driver.NoLink {
-		course.FirstSlaveAddress = offset // first slave
-	} else {
-		// find the last certificate in the list to update its Next to the new certificate's offset.
-		var lastCertificate models.Certificate
-		currentOffset := course.FirstSlaveAddress
-		var prevOffset int64 = driver.NoLink
-
-		for currentOffset != driver.NoLink {
-			err := driver.ReadModel(r.App.Slave.FL, &lastCertificate, currentOffset, io.SeekStart)
-			if err != nil {
-				fmt.Printf("error reading slave model: %s\n", err)
-				return
-			}
-
-			prevOffset = currentOffset
-			currentOffset = lastCertificate.Next
-		}
-
-		if prevOffset != driver.NoLink {
-			lastCertificate.Next = offset
-			newCertificate.Previous = prevOffset
-
-			if err := driver.WriteModel(r.App.Slave.FL, &lastCertificate, prevOffset, io.SeekStart); err != nil {
-				fmt.Printf("error updating last slave record: %s\n", err)
-				return
-			}
-		}
-	}
-
-	if err := driver.WriteModel(r.App.Slave.FL, &newCertificate, offset, io.SeekStart); err != nil {
-		log.Println(err)
+	if err := slave.Append(record, offset); err != nil {
+		fmt.Printf("error linking slave record: %s\n", err)
 		return
 	}
 
-	// Correctly update the course's first slave address if this is the first slave or if needed.
-	if err := driver.WriteModel(r.App.Master.FL, &course, int64(masterAddress), io.SeekStart); err != nil {
-		fmt.Printf("error updating master record with ID %d: %s\n", courseID, err)
+	// Update indices with the correct offset after potentially using junk space or appending.
+	if err := slave.AddIndex(id, uint32(offset)); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	// Update indices with the correct offset after potentially using junk space or appending.
-	r.App.Slave.Indices = driver.AddIndex(r.App.Slave.Indices, uint32(id), uint32(offset))
+	if err := slave.IndexRecord(record, uint32(offset)); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := slave.Advance(id); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := driver.Commit(); err != nil {
+		fmt.Printf("error committing transaction: %v\n", err)
+		return
+	}
+
+	printInserted(id, auto)
+}
+
+// printInserted reports a successful insertion, along with the ID assigned by the auto-increment sequence.
+func printInserted(id uint32, auto bool) {
+	if auto {
+		fmt.Printf("OK, ID %d\n", id)
+		return
+	}
 
 	fmt.Println("OK")
 }
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/driver"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+	"strings"
+)
+
+// Link handles linking two records through the junction table, given by their IDs in the order of the links of the
+// junction table and followed by the values of its other fields.
+func (r *Repository) Link(_ *cobra.Command, args []string) {
+	junction, err := r.junctionTable(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	values, err := linkValues(junction.Schema, args[1:3], args[3:])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	record, auto, err := parseRecord(junction, values, r.App.Validation)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	insertMaster(junction, record, auto)
+}
+
+// linkValues arranges the IDs of the linked records and the values of the other fields of the junction table in the
+// order of its schema, leaving out the key.
+func linkValues(schema *models.Schema, ids, others []string) ([]string, error) {
+	var names []string
+	for _, field := range schema.Fields[1:] {
+		if schema.LinkOf(field.Name) < 0 {
+			names = append(names, field.Name)
+		}
+	}
+
+	if len(others) != len(names) {
+		return nil, fmt.Errorf("error: %s takes %d values after the IDs (%s), got %d",
+			schema.Name, len(names), strings.Join(names, ", "), len(others))
+	}
+
+	values := make([]string, 0, len(schema.Fields)-1)
+	for _, field := range schema.Fields[1:] {
+		if i := schema.LinkOf(field.Name); i >= 0 {
+			values = append(values, ids[i])
+		} else {
+			values = append(values, others[0])
+			others = others[1:]
+		}
+	}
+
+	return values, nil
+}
+
+// Unlink handles removing the link between two records from the junction table, given by their IDs in the order of
+// the links of the junction table.
+func (r *Repository) Unlink(_ *cobra.Command, args []string) {
+	junction, err := r.junctionTable(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var ids [2]uint32
+	for i := range ids {
+		if ids[i], err = parseID(args[i+1]); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	entries, err := junction.LinksOf(0, ids[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var links []driver.IndexTable
+	for _, entry := range entries {
+		record, err := junction.ReadRecord(int64(entry.Address))
+		if err != nil {
+			fmt.Printf("error reading link: %s\n", err)
+			return
+		}
+
+		if junction.LinkedKey(record, 1) == ids[1] {
+			links = append(links, entry)
+		}
+	}
+
+	if len(links) == 0 {
+		fmt.Printf("%s %d is not linked to %s %d\n", junction.Links[0].Schema.Name, ids[0],
+			junction.Links[1].Schema.Name, ids[1])
+		return
+	}
+
+	if err := driver.Begin(); err != nil {
+		fmt.Printf("error starting transaction: %v\n", err)
+		return
+	}
+	defer driver.Rollback()
+
+	if _, err := deleteLinks(junction, links); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if err := driver.Commit(); err != nil {
+		fmt.Printf("error committing transaction: %v\n", err)
+		return
+	}
+
+	fmt.Println("OK")
+}
+
+// Linked handles printing the records linked through the junction table to the record of the given table with the
+// given ID. Queried fields and a "where" clause work as with get-m.
+func (r *Repository) Linked(_ *cobra.Command, args []string) {
+	junction, err := r.junctionTable(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	side := junction.Schema.LinkIndex(args[1])
+	if side < 0 {
+		fmt.Printf("%s doesn't link %s\n", junction.Schema.Name, args[1])
+		return
+	}
+	other := junction.Links[1-side]
+
+	id, err := parseID(args[2])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if !junction.Links[side].RecordExists(id) {
+		fmt.Printf("the record with ID %d was not found in %s\n", id, args[1])
+		return
+	}
+
+	entries, err := junction.LinksOf(side, id)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var targets []driver.IndexTable
+	for _, entry := range entries {
+		record, err := junction.ReadRecord(int64(entry.Address))
+		if err != nil {
+			fmt.Printf("error reading link: %s\n", err)
+			return
+		}
+
+		key := junction.LinkedKey(record, 1-side)
+		if address, ok := other.GetAddressByIndex(key); ok {
+			targets = append(targets, driver.IndexTable{Index: key, Address: address})
+		}
+	}
+
+	records, err := readRecordsByID(other, targets)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	printMasterQuery(other.Schema, records, args[3:])
+}
+
+// junctionTable returns the junction table with the given name.
+func (r *Repository) junctionTable(name string) (*driver.Table, error) {
+	table := r.App.Table(name)
+	if table == nil {
+		return nil, fmt.Errorf("table %s was not found", name)
+	}
+
+	if !table.Schema.IsJunction() {
+		return nil, fmt.Errorf("%s is not a junction table", name)
+	}
+
+	return table, nil
+}
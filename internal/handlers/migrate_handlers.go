@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/driver"
+	"strings"
+)
+
+// Migrate handles rewriting the files of every table in the layout of their current schemas. With --dry-run, the
+// changes are reported without touching any file.
+func (r *Repository) Migrate(cmd *cobra.Command, _ []string) {
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		fmt.Printf("error parsing flags: %v\n", err)
+		return
+	}
+
+	reports, err := driver.Migrate(r.App.Schemas, dryRun)
+	if err != nil {
+		fmt.Printf("error migrating tables: %v\n", err)
+		return
+	}
+
+	for _, report := range reports {
+		printReport(report)
+	}
+
+	if dryRun {
+		fmt.Println("dry run, no files were changed")
+		return
+	}
+
+	fmt.Println("OK")
+}
+
+// printReport prints how the .fl file of a table is rewritten by a migration.
+func printReport(report driver.MigrationReport) {
+	if report.UpToDate {
+		fmt.Printf("%s: up to date\n", report.File)
+		return
+	}
+
+	fmt.Printf("%s: record size %d -> %d, %d records\n", report.File, report.OldSize, report.NewSize, report.Records)
+	if len(report.Changes) > 0 {
+		fmt.Printf("  fields: %s\n", strings.Join(report.Changes, ", "))
+	}
+	if report.Dropped > 0 {
+		fmt.Printf("  %d deleted records dropped\n", report.Dropped)
+	}
+	if report.Truncated > 0 {
+		fmt.Printf("  %d values truncated to fit narrower fields\n", report.Truncated)
+	}
+	if report.Unlinked > 0 {
+		fmt.Printf("  %d links to missing records cleared\n", report.Unlinked)
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Search handles full-text search over the searchable field of the master table, printing the matching entries
+// ranked by relevance.
+func (r *Repository) Search(cmd *cobra.Command, args []string) {
+	master, err := r.masterTable(cmd)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if len(master.Schema.Searchable) == 0 {
+		fmt.Printf("%s has no searchable field\n", master.Schema.Name)
+		return
+	}
+
+	matches, err := master.Search(master.Schema.Searchable[0], strings.Join(args, " "))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if len(matches) == 0 {
+		fmt.Println("nothing found")
+		return
+	}
+
+	headers := append(fieldColumns(master.Schema), "SCORE")
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(headers)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	for _, match := range matches {
+		record, err := master.ReadRecord(int64(match.Address))
+		if err != nil {
+			fmt.Printf("error reading data: %s\n", err)
+			return
+		}
+
+		row := formatRow(master.Schema, record, headers[:len(headers)-1])
+		table.Append(append(row, strconv.FormatFloat(match.Score, 'f', 3, 64)))
+	}
+
+	table.Render()
+}
@@ -5,97 +5,161 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/driver"
 	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
-	"io"
-	"strconv"
 )
 
-// UpdateMaster handles updating fields of the master entry by its ID.
-func (r *Repository) UpdateMaster(_ *cobra.Command, args []string) {
+// skipValue is the argument that leaves a field unchanged. The text - itself is given escaped with
+// models.EscapePrefix.
+const skipValue = "-"
+
+// UpdateMaster handles updating fields of the master entry by its ID. Fields are given in the order of the schema,
+// after the ID, and "-" leaves a field unchanged.
+func (r *Repository) UpdateMaster(cmd *cobra.Command, args []string) {
+	master, err := r.masterTable(cmd)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	updateRecord(master, args, editableFields(master), r.App.Validation)
+}
+
+// UpdateSlave handles updating fields of the slave entry by its ID. Fields are given in the order of the schema,
+// after the ID, and "-" leaves a field unchanged. Changing the ID of the master record moves the entry to the end of
+// the chain of its new master record.
+func (r *Repository) UpdateSlave(cmd *cobra.Command, args []string) {
+	slave, err := r.slaveTable(cmd)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	updateRecord(slave, args, editableFields(slave), r.App.Validation)
+}
+
+// editableFields returns the positions of the fields that can be updated: every field but the key.
+func editableFields(table *driver.Table) []int {
+	var fields []int
+	for i := range table.Schema.Fields[1:] {
+		fields = append(fields, i+1)
+	}
+
+	return fields
+}
+
+// updateRecord updates the given fields of the record whose ID is the first argument with the following arguments.
+func updateRecord(table *driver.Table, args []string, fields []int, validation models.Validation) {
 	if len(args) < 2 {
 		fmt.Printf("error: at least 2 arguments are required, got %d\n", len(args))
 		return
 	}
 
-	id, err := strconv.Atoi(args[0])
+	id, err := parseID(args[0])
 	if err != nil {
-		fmt.Printf("error parsing ID: %v\n", err)
+		fmt.Println(err)
 		return
 	}
 
-	address, ok := driver.GetAddressByIndex(r.App.Master.Indices, uint32(id))
+	address, ok := table.GetAddressByIndex(id)
 	if !ok {
 		fmt.Printf("the record with ID %d was not found\n", id)
 		return
 	}
 
-	var course models.Course
-	err = driver.ReadModel(r.App.Master.FL, &course, int64(address), io.SeekStart)
+	record, err := table.ReadRecord(int64(address))
 	if err != nil {
-		fmt.Printf("error retrieving model: %s\n", err)
+		fmt.Printf("error retrieving record: %s\n", err)
 		return
 	}
 
-	if len(args) > 1 && args[1] != "-" {
-		clear(course.Title[:])
-		copy(course.Title[:], args[1])
+	oldRecord := *record
+	oldRecord.Values = append([]any{}, record.Values...)
+
+	updated := false
+	for i, arg := range args[1:] {
+		if i >= len(fields) {
+			fmt.Printf("error: at most %d fields can be updated, got %d\n", len(fields), len(args)-1)
+			return
+		}
+		if arg == skipValue {
+			continue
+		}
+
+		field := table.Schema.Fields[fields[i]]
+		value, err := parseValue(field, arg, validation)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		record.Values[fields[i]] = value
+		updated = true
 	}
 
-	if len(args) > 2 && args[2] != "-" {
-		clear(course.Category[:])
-		copy(course.Category[:], args[2])
+	if !updated {
+		fmt.Println("nothing to update")
+		return
 	}
 
-	if len(args) > 3 && args[3] != "-" {
-		clear(course.Instructor[:])
-		copy(course.Instructor[:], args[3])
+	reparented := table.Schema.IsSlave() && reparenting(table, &oldRecord, record)
+	if reparented {
+		if parent, ok := table.ParentKey(record); ok && !table.Parent.RecordExists(parent) {
+			fmt.Printf("the master record with ID %d was not found\n", parent)
+			return
+		}
 	}
 
-	if err := driver.WriteModel(r.App.Master.FL, &course, int64(address), io.SeekStart); err != nil {
-		fmt.Printf("error updating record: %s\n", err)
+	if err := checkLinks(table, record); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	fmt.Println("OK")
-}
+	if err := table.CheckUnique(record); err != nil {
+		fmt.Println(err)
+		return
+	}
 
-// UpdateSlave handles updating fields of the slave entry by its ID.
-func (r *Repository) UpdateSlave(_ *cobra.Command, args []string) {
-	if len(args) < 2 {
-		fmt.Printf("error: at least 2 arguments are required, got %d\n", len(args))
+	if err := driver.Begin(); err != nil {
+		fmt.Printf("error starting transaction: %v\n", err)
 		return
 	}
+	defer driver.Rollback()
 
-	id, err := strconv.Atoi(args[0])
-	if err != nil {
-		fmt.Printf("error parsing ID: %v\n", err)
+	if reparented {
+		if err := table.Reparent(&oldRecord, record, int64(address)); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	if err := table.WriteRecord(int64(address), record); err != nil {
+		fmt.Printf("error updating record: %s\n", err)
 		return
 	}
 
-	address, ok := driver.GetAddressByIndex(r.App.Slave.Indices, uint32(id))
-	if !ok {
-		fmt.Printf("the record with ID %d was not found\n", id)
+	if err := table.UnindexRecord(&oldRecord); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	var certificate models.Certificate
-	err = driver.ReadModel(r.App.Slave.FL, &certificate, int64(address), io.SeekStart)
-	if err != nil {
-		fmt.Printf("error retrieving model: %s\n", err)
+	if err := table.IndexRecord(record, address); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	if len(args) > 1 && args[1] != "*" {
-		clear(certificate.IssuedTo[:])
-		copy(certificate.IssuedTo[:], args[1])
-	} else {
-		fmt.Println("nothing to update")
+	if err := compactHeap(table); err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	if err := driver.WriteModel(r.App.Slave.FL, &certificate, int64(address), io.SeekStart); err != nil {
-		fmt.Printf("error updating record: %s\n", err)
+	if err := driver.Commit(); err != nil {
+		fmt.Printf("error committing transaction: %v\n", err)
 		return
 	}
 
 	fmt.Println("OK")
 }
+
+// reparenting reports whether the update changes the master record of the slave record.
+func reparenting(slave *driver.Table, old, record *models.Record) bool {
+	i := slave.Schema.FieldIndex(slave.Schema.ParentField)
+	return slave.Schema.Fields[i].Compare(old.Values[i], record.Values[i]) != 0
+}
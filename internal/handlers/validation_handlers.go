@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/vladyslavpavlenko/go-dbms-lab/internal/models"
+)
+
+// Validation handles printing or setting the validation mode. In strict mode, text values that don't fit their
+// fields are refused, while in lenient mode they are cut at a rune boundary.
+func (r *Repository) Validation(_ *cobra.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Println(r.App.Validation)
+		return
+	}
+
+	validation, err := models.ParseValidation(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	r.App.Validation = validation
+
+	fmt.Println("OK")
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Action decides what happens to the subrecords of a master record when it's deleted.
+type Action uint8
+
+const (
+	// Cascade deletes the subrecords along with their master record.
+	Cascade Action = iota
+	// Restrict refuses to delete a master record that has subrecords.
+	Restrict
+	// SetNull keeps the subrecords as orphans, setting the field holding the key of their master record to NULL.
+	SetNull
+)
+
+// actionNames maps referential actions to the names they are declared with.
+var actionNames = map[Action]string{
+	Cascade:  "cascade",
+	Restrict: "restrict",
+	SetNull:  "set-null",
+}
+
+// String returns the name of the action.
+func (a Action) String() string {
+	if name, ok := actionNames[a]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("action(%d)", uint8(a))
+}
+
+// ParseAction returns the referential action with the given name.
+func ParseAction(name string) (Action, error) {
+	for a, actionName := range actionNames {
+		if strings.EqualFold(actionName, name) {
+			return a, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown action %s, expected cascade, restrict or set-null", name)
+}
+
+// MarshalText encodes the action by its name, so that catalogs stay readable.
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText decodes an action encoded by its name.
+func (a *Action) UnmarshalText(text []byte) error {
+	parsed, err := ParseAction(string(text))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+
+	return nil
+}
@@ -0,0 +1,347 @@
+package models
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Type is the type of a field.
+type Type uint8
+
+const (
+	TypeUint32 Type = iota + 1
+	TypeText
+	TypeVarText
+	TypeInt
+	TypeFloat
+	TypeBool
+	TypeDate
+	TypeEnum
+)
+
+// typeNames maps field types to the names they are declared with.
+var typeNames = map[Type]string{
+	TypeUint32:  "uint32",
+	TypeText:    "text",
+	TypeVarText: "varchar",
+	TypeInt:     "int",
+	TypeFloat:   "float",
+	TypeBool:    "bool",
+	TypeDate:    "date",
+	TypeEnum:    "enum",
+}
+
+// DateLayout is the layout dates are parsed and printed with.
+const DateLayout = "2006-01-02"
+
+// NullLiteral is the REPL argument setting a nullable field to NULL.
+const NullLiteral = "NULL"
+
+// EscapePrefix makes the rest of a REPL argument a literal value, so that text such as NULL or - can be stored. A
+// value starting with the prefix itself is given with the prefix doubled.
+const EscapePrefix = `\`
+
+// MaxOptions is the maximum number of options of an enum field, whose values are stored as a single byte.
+const MaxOptions = 256
+
+// String returns the name of the type.
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("type(%d)", uint8(t))
+}
+
+// ParseType returns the type declared with the given name.
+func ParseType(name string) (Type, error) {
+	for t, typeName := range typeNames {
+		if strings.EqualFold(typeName, name) {
+			return t, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown type %s", name)
+}
+
+// MarshalText encodes the type by its name, so that catalogs stay readable.
+func (t Type) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a type encoded by its name.
+func (t *Type) UnmarshalText(text []byte) error {
+	parsed, err := ParseType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+
+	return nil
+}
+
+// Field describes a column of a table. Size is the capacity in bytes of text fields, while varchar fields hold text
+// of any length in the heap file of their table. Options lists the values an enum field can take, and Nullable
+// fields can be NULL.
+//
+// Values of fields are held as uint32 for TypeUint32, int64 for TypeInt, float64 for TypeFloat, bool for TypeBool,
+// time.Time at midnight UTC for TypeDate, and string for text fields and for TypeEnum, which holds one of its
+// options. NULL is held as nil.
+type Field struct {
+	Name     string   `json:"name"`
+	Type     Type     `json:"type"`
+	Size     int      `json:"size,omitempty"`
+	Options  []string `json:"options,omitempty"`
+	Nullable bool     `json:"nullable,omitempty"`
+}
+
+// fieldSpec matches column declarations such as id:uint32, title:text(50), level:enum(beginner,advanced) or
+// category:text(15)?, where the trailing question mark makes the column nullable.
+var fieldSpec = regexp.MustCompile(`^(\w+):(\w+)(?:\(([^()]+)\))?(\?)?$`)
+
+// ParseField parses a column declaration of the form <name>:<type>, where text columns give their size in
+// parentheses, e.g. title:text(50), and enum columns their comma-separated options, e.g. level:enum(basic,expert).
+// A trailing question mark declares a nullable column, e.g. instructor:varchar?.
+func ParseField(spec string) (Field, error) {
+	match := fieldSpec.FindStringSubmatch(spec)
+	if match == nil {
+		return Field{}, fmt.Errorf("invalid column %q, expected <name>:<type>, <name>:text(<size>) or "+
+			"<name>:enum(<option>,...), followed by ? if it's nullable", spec)
+	}
+
+	fieldType, err := ParseType(match[2])
+	if err != nil {
+		return Field{}, fmt.Errorf("invalid column %q: %w", spec, err)
+	}
+
+	field := Field{Name: strings.ToLower(match[1]), Type: fieldType, Nullable: match[4] != ""}
+	switch {
+	case fieldType == TypeText && match[3] == "":
+		return Field{}, fmt.Errorf("invalid column %q: text columns need a size, e.g. %s:text(50)", spec, match[1])
+	case fieldType == TypeEnum && match[3] == "":
+		return Field{}, fmt.Errorf("invalid column %q: enum columns need options, e.g. %s:enum(a,b)", spec, match[1])
+	case fieldType != TypeText && fieldType != TypeEnum && match[3] != "":
+		return Field{}, fmt.Errorf("invalid column %q: only text and enum columns take parameters", spec)
+	case fieldType == TypeText:
+		field.Size, err = strconv.Atoi(match[3])
+		if err != nil {
+			return Field{}, fmt.Errorf("invalid column %q: %w", spec, err)
+		}
+	case fieldType == TypeEnum:
+		for _, option := range strings.Split(match[3], ",") {
+			field.Options = append(field.Options, strings.TrimSpace(option))
+		}
+	}
+
+	if err := field.validate(); err != nil {
+		return Field{}, fmt.Errorf("invalid column %q: %w", spec, err)
+	}
+
+	return field, nil
+}
+
+// validate checks the parameters of the field.
+func (f Field) validate() error {
+	if _, ok := typeNames[f.Type]; !ok {
+		return fmt.Errorf("field %s has unknown %s", f.Name, f.Type)
+	}
+
+	if f.Type == TypeText && f.Size <= 0 {
+		return fmt.Errorf("text field %s must have a positive size", f.Name)
+	}
+
+	if f.Type != TypeEnum {
+		return nil
+	}
+
+	if len(f.Options) == 0 || len(f.Options) > MaxOptions {
+		return fmt.Errorf("enum field %s must have between 1 and %d options", f.Name, MaxOptions)
+	}
+
+	seen := make(map[string]bool)
+	for _, option := range f.Options {
+		if option == "" || seen[strings.ToLower(option)] {
+			return fmt.Errorf("enum field %s has an empty or repeated option", f.Name)
+		}
+		seen[strings.ToLower(option)] = true
+	}
+
+	return nil
+}
+
+// String returns the declaration of the field, as accepted by ParseField.
+func (f Field) String() string {
+	if f.Nullable {
+		return fmt.Sprintf("%s:%s?", f.Name, f.TypeName())
+	}
+
+	return fmt.Sprintf("%s:%s", f.Name, f.TypeName())
+}
+
+// TypeName returns the type of the field along with its parameters, e.g. text(50) or enum(basic,expert).
+func (f Field) TypeName() string {
+	switch f.Type {
+	case TypeText:
+		return fmt.Sprintf("%s(%d)", f.Type, f.Size)
+	case TypeEnum:
+		return fmt.Sprintf("%s(%s)", f.Type, strings.Join(f.Options, ","))
+	}
+
+	return f.Type.String()
+}
+
+// IsText reports whether the field holds text.
+func (f Field) IsText() bool {
+	return f.Type == TypeText || f.Type == TypeVarText
+}
+
+// Zero returns the value of the field in a new record.
+func (f Field) Zero() any {
+	switch f.Type {
+	case TypeUint32:
+		return uint32(0)
+	case TypeInt:
+		return int64(0)
+	case TypeFloat:
+		return float64(0)
+	case TypeBool:
+		return false
+	case TypeDate:
+		return time.Unix(0, 0).UTC()
+	case TypeEnum:
+		return f.Options[0]
+	}
+
+	return ""
+}
+
+// Parse converts the REPL argument into a value of the field, or nil for NullLiteral unless it is escaped with
+// EscapePrefix. Text is validated against the field with the given validation mode, and truncated reports whether it
+// had to be cut to fit.
+func (f Field) Parse(arg string, validation Validation) (value any, truncated bool, err error) {
+	arg, escaped := strings.CutPrefix(arg, EscapePrefix)
+	if arg == NullLiteral && !escaped {
+		if !f.Nullable {
+			return nil, false, &ValidationError{Field: f.Name, Reason: "the field is not nullable"}
+		}
+		return nil, false, nil
+	}
+
+	switch f.Type {
+	case TypeUint32:
+		value, err := strconv.ParseUint(arg, 10, 32)
+		if err != nil {
+			return nil, false, fmt.Errorf("error parsing %s: %w", f.Name, err)
+		}
+		return uint32(value), false, nil
+	case TypeInt:
+		value, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("error parsing %s: %w", f.Name, err)
+		}
+		return value, false, nil
+	case TypeFloat:
+		value, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("error parsing %s: %w", f.Name, err)
+		}
+		return value, false, nil
+	case TypeBool:
+		value, err := strconv.ParseBool(arg)
+		if err != nil {
+			return nil, false, fmt.Errorf("error parsing %s: %w", f.Name, err)
+		}
+		return value, false, nil
+	case TypeDate:
+		value, err := time.Parse(DateLayout, arg)
+		if err != nil {
+			return nil, false, fmt.Errorf("error parsing %s: expected a date such as 2024-01-31", f.Name)
+		}
+		return value, false, nil
+	case TypeEnum:
+		for _, option := range f.Options {
+			if strings.EqualFold(option, arg) {
+				return option, false, nil
+			}
+		}
+		return nil, false, &ValidationError{
+			Field:  f.Name,
+			Reason: fmt.Sprintf("expected one of %s", strings.Join(f.Options, ", ")),
+		}
+	default:
+		return f.validateText(arg, validation)
+	}
+}
+
+// Format converts the value of the field into its printed form.
+func (f Field) Format(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return NullLiteral
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(DateLayout)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// Compare compares two values of the field, returning a negative number, zero or a positive number if the first
+// value is less than, equal to or greater than the second one. Enum values are ordered as their options are declared,
+// false is less than true and NULL is less than any other value.
+func (f Field) Compare(a, b any) int {
+	if a == nil || b == nil {
+		return cmp.Compare(nullRank(a), nullRank(b))
+	}
+
+	switch f.Type {
+	case TypeUint32:
+		return cmp.Compare(a.(uint32), b.(uint32))
+	case TypeInt:
+		return cmp.Compare(a.(int64), b.(int64))
+	case TypeFloat:
+		return cmp.Compare(a.(float64), b.(float64))
+	case TypeBool:
+		return cmp.Compare(boolRank(a.(bool)), boolRank(b.(bool)))
+	case TypeDate:
+		return a.(time.Time).Compare(b.(time.Time))
+	case TypeEnum:
+		return cmp.Compare(f.OptionIndex(a.(string)), f.OptionIndex(b.(string)))
+	}
+
+	return strings.Compare(a.(string), b.(string))
+}
+
+// OptionIndex returns the position of the option among the options of an enum field, or -1 if there is none.
+func (f Field) OptionIndex(option string) int {
+	for i, o := range f.Options {
+		if o == option {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// nullRank orders NULL before other values.
+func nullRank(value any) int {
+	if value == nil {
+		return 0
+	}
+
+	return 1
+}
+
+// boolRank orders false before true.
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
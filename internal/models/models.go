@@ -1,31 +1,436 @@
 package models
 
-// Master represents a master record.
-type Master struct {
-	FirstSlaveAddress int64
-	Presence          bool
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Schema describes a table. The first field is the uint32 key. A slave table names its master table in Parent and
+// the field holding the key of its master record in ParentField, while a master table lists its slave tables in
+// Children, each of them getting a chain of subrecords starting at every master record. Indexed and Searchable list
+// the fields with secondary and full-text indexes, Unique lists the sets of fields no two records can share the
+// values of, and AutoIncrement gives the table a sequence assigning the keys of new records. OnDelete decides what
+// happens to the records of a slave table when their master record is deleted. A junction table relates the records
+// of two other tables many-to-many, every record linking a pair of them through the fields named in Links.
+type Schema struct {
+	Name          string     `json:"name"`
+	Fields        []Field    `json:"fields"`
+	Parent        string     `json:"parent,omitempty"`
+	ParentField   string     `json:"parent_field,omitempty"`
+	Children      []string   `json:"children,omitempty"`
+	Indexed       []string   `json:"indexed,omitempty"`
+	Searchable    []string   `json:"searchable,omitempty"`
+	Unique        [][]string `json:"unique,omitempty"`
+	AutoIncrement bool       `json:"auto_increment,omitempty"`
+	OnDelete      Action     `json:"on_delete,omitempty"`
+	Links         []Link     `json:"links,omitempty"`
+}
+
+// Link names the table whose records the field of a junction table holds the keys of.
+type Link struct {
+	Field string `json:"field"`
+	Table string `json:"table"`
 }
 
-// Slave represents a slave record.
-type Slave struct {
+// HeapRef locates the value of a varchar field in the heap file of its table. Value is the text stored there, so
+// that writing a record only moves the values that changed. A zero HeapRef holds an empty value.
+type HeapRef struct {
+	Offset int64
+	Length uint32
+	Value  string
+}
+
+// Chain holds the addresses of the first and the last subrecords of a master record in one of its slave tables, so
+// that subrecords are appended without following the chain, and the number of subrecords, so that they are counted
+// without following it either.
+type Chain struct {
+	First int64
+	Last  int64
+	Count uint32
+}
+
+// Record is a row of a table. Values holds one value per field of the schema, of the Go type described by Field or nil
+// for NULL, and Refs locates the values of varchar fields. Chains has one entry per slave table of a master table,
+// and Previous and Next link the records of a slave table into chains.
+type Record struct {
+	Values   []any
+	Refs     []HeapRef
+	Chains   []Chain
 	Previous int64
 	Next     int64
 	Presence bool
 }
 
-// Course is the course model.
-type Course struct {
-	ID         uint32
-	Title      [50]byte
-	Category   [15]byte
-	Instructor [30]byte
-	Master
+// Courses and Certificates are the tables the catalog starts with.
+var (
+	Courses = &Schema{
+		Name: "courses",
+		Fields: []Field{
+			{Name: "id", Type: TypeUint32},
+			{Name: "title", Type: TypeVarText},
+			{Name: "category", Type: TypeText, Size: 15, Nullable: true},
+			{Name: "instructor", Type: TypeVarText, Nullable: true},
+			{Name: "price", Type: TypeFloat},
+			{Name: "duration", Type: TypeInt},
+			{Name: "published", Type: TypeDate},
+			{Name: "level", Type: TypeEnum, Options: []string{"beginner", "intermediate", "advanced"}},
+		},
+		Children:      []string{"certificates"},
+		Indexed:       []string{"category"},
+		Searchable:    []string{"title"},
+		Unique:        [][]string{{"title"}},
+		AutoIncrement: true,
+	}
+
+	Certificates = &Schema{
+		Name: "certificates",
+		Fields: []Field{
+			{Name: "id", Type: TypeUint32},
+			{Name: "course_id", Type: TypeUint32},
+			{Name: "issued_to", Type: TypeVarText},
+			{Name: "issued_on", Type: TypeDate},
+		},
+		Parent:        "courses",
+		ParentField:   "course_id",
+		Unique:        [][]string{{"course_id", "issued_to"}},
+		AutoIncrement: true,
+	}
+
+	Defaults = []*Schema{Courses, Certificates}
+)
+
+// tableName matches the names tables can have, which are also the names of their files.
+var tableName = regexp.MustCompile(`^\w+$`)
+
+// HasNullable reports whether any field of the table is nullable.
+func (s *Schema) HasNullable() bool {
+	for _, field := range s.Fields {
+		if field.Nullable {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsMaster reports whether the table has slave tables.
+func (s *Schema) IsMaster() bool {
+	return len(s.Children) > 0
+}
+
+// IsJunction reports whether the table links the records of two other tables.
+func (s *Schema) IsJunction() bool {
+	return len(s.Links) > 0
+}
+
+// LinkIndex returns the position of the link to the given table, or -1 if there is none.
+func (s *Schema) LinkIndex(table string) int {
+	return slices.IndexFunc(s.Links, func(link Link) bool { return link.Table == table })
+}
+
+// LinkOf returns the position of the link held by the field with the given name, or -1 if it holds none.
+func (s *Schema) LinkOf(name string) int {
+	return slices.IndexFunc(s.Links, func(link Link) bool { return strings.EqualFold(link.Field, name) })
+}
+
+// IsLinkField reports whether the field with the given name holds the keys of the records of a linked table.
+func (s *Schema) IsLinkField(name string) bool {
+	return s.LinkOf(name) >= 0
+}
+
+// AddLink declares that the field with the given name holds the keys of the records of the table, indexing it so
+// that links can be followed from the table's side.
+func (s *Schema) AddLink(field, table string) error {
+	if s.IsLinkField(field) {
+		return fmt.Errorf("column %s already links %s to another table", field, s.Name)
+	}
+
+	s.Links = append(s.Links, Link{Field: strings.ToLower(field), Table: table})
+	if !containsName(s.Indexed, field) {
+		s.Indexed = append(s.Indexed, strings.ToLower(field))
+	}
+
+	return nil
+}
+
+// IsSlave reports whether the table is a slave of another table.
+func (s *Schema) IsSlave() bool {
+	return s.Parent != ""
+}
+
+// Clone returns a copy of the schema that can be changed without affecting the original.
+func (s *Schema) Clone() *Schema {
+	clone := *s
+	clone.Fields = append([]Field{}, s.Fields...)
+	clone.Children = append([]string{}, s.Children...)
+	clone.Indexed = append([]string{}, s.Indexed...)
+	clone.Searchable = append([]string{}, s.Searchable...)
+	clone.Unique = make([][]string, len(s.Unique))
+	for i, fields := range s.Unique {
+		clone.Unique[i] = append([]string{}, fields...)
+	}
+	clone.Links = append([]Link{}, s.Links...)
+
+	return &clone
+}
+
+// AddField appends a field to the schema.
+func (s *Schema) AddField(field Field) error {
+	if s.FieldIndex(field.Name) >= 0 {
+		return fmt.Errorf("column %s already exists in %s", field.Name, s.Name)
+	}
+
+	s.Fields = append(s.Fields, field)
+	return nil
+}
+
+// DropField removes the field with the given name from the schema, along with its indexes. The key and the field
+// holding the key of the master record can't be dropped.
+func (s *Schema) DropField(name string) error {
+	i := s.FieldIndex(name)
+	switch {
+	case i < 0:
+		return fmt.Errorf("column %s was not found in %s", name, s.Name)
+	case i == 0:
+		return fmt.Errorf("the key column of %s can't be dropped", s.Name)
+	case s.IsSlave() && strings.EqualFold(name, s.ParentField):
+		return fmt.Errorf("column %s holds the ID of the master record and can't be dropped", name)
+	case s.IsLinkField(name):
+		return fmt.Errorf("column %s links %s to another table and can't be dropped", name, s.Name)
+	}
+
+	s.Fields = append(s.Fields[:i:i], s.Fields[i+1:]...)
+	s.Indexed = removeName(s.Indexed, name)
+	s.Searchable = removeName(s.Searchable, name)
+	s.Unique = slices.DeleteFunc(s.Unique, func(fields []string) bool { return containsName(fields, name) })
+
+	return nil
+}
+
+// ResizeField changes the capacity of the text field with the given name.
+func (s *Schema) ResizeField(name string, size int) error {
+	i := s.FieldIndex(name)
+	switch {
+	case i < 0:
+		return fmt.Errorf("column %s was not found in %s", name, s.Name)
+	case s.Fields[i].Type != TypeText:
+		return fmt.Errorf("column %s is not a text column, only text columns can be resized", name)
+	case size <= 0:
+		return fmt.Errorf("the size of column %s must be positive", name)
+	}
+
+	s.Fields[i].Size = size
+	return nil
+}
+
+// MakeNullable allows the field with the given name to be NULL. The key can't be nullable, while a slave record with a
+// NULL parent field is an orphan, linked to no master record.
+func (s *Schema) MakeNullable(name string) error {
+	i := s.FieldIndex(name)
+	switch {
+	case i < 0:
+		return fmt.Errorf("column %s was not found in %s", name, s.Name)
+	case i == 0:
+		return fmt.Errorf("column %s is the key of %s and can't be nullable", name, s.Name)
+	case s.IsLinkField(name):
+		return fmt.Errorf("column %s links %s to another table and can't be nullable", name, s.Name)
+	}
+
+	s.Fields[i].Nullable = true
+	return nil
+}
+
+// SetOnDelete sets what happens to the records of the slave table when their master record is deleted. SetNull makes
+// the parent field nullable, so that the records can be kept as orphans.
+func (s *Schema) SetOnDelete(action Action) error {
+	if !s.IsSlave() {
+		return fmt.Errorf("%s is not a slave table", s.Name)
+	}
+
+	if action == SetNull {
+		if err := s.MakeNullable(s.ParentField); err != nil {
+			return err
+		}
+	}
+
+	s.OnDelete = action
+	return nil
+}
+
+// AddUnique adds a unique constraint on the given fields.
+func (s *Schema) AddUnique(fields []string) error {
+	if s.UniqueIndex(fields) >= 0 {
+		return fmt.Errorf("%s already has a unique constraint on %s", s.Name, strings.Join(fields, ", "))
+	}
+
+	s.Unique = append(s.Unique, fields)
+	return nil
+}
+
+// DropUnique removes the unique constraint on the given fields.
+func (s *Schema) DropUnique(fields []string) error {
+	i := s.UniqueIndex(fields)
+	if i < 0 {
+		return fmt.Errorf("%s has no unique constraint on %s", s.Name, strings.Join(fields, ", "))
+	}
+
+	s.Unique = slices.Delete(s.Unique, i, i+1)
+	return nil
+}
+
+// UniqueIndex returns the position of the unique constraint on the given fields, in any order and ignoring case, or
+// -1 if there is none.
+func (s *Schema) UniqueIndex(fields []string) int {
+	return slices.IndexFunc(s.Unique, func(unique []string) bool {
+		if len(unique) != len(fields) {
+			return false
+		}
+		for _, name := range fields {
+			if !containsName(unique, name) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// containsName reports whether the names contain the given one, ignoring case.
+func containsName(names []string, name string) bool {
+	return slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(n, name) })
+}
+
+// removeName returns the names without the given one, ignoring case.
+func removeName(names []string, name string) []string {
+	var kept []string
+	for _, n := range names {
+		if !strings.EqualFold(n, name) {
+			kept = append(kept, n)
+		}
+	}
+
+	return kept
+}
+
+// FieldIndex returns the position of the field with the given name, ignoring case, or -1 if there is none.
+func (s *Schema) FieldIndex(name string) int {
+	for i, field := range s.Fields {
+		if strings.EqualFold(field.Name, name) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Validate checks that the schema describes a table the driver can store.
+func (s *Schema) Validate() error {
+	if !tableName.MatchString(s.Name) {
+		return fmt.Errorf("invalid table name %q, only letters, digits and underscores are allowed", s.Name)
+	}
+
+	if len(s.Fields) == 0 || s.Fields[0].Type != TypeUint32 || s.Fields[0].Nullable {
+		return fmt.Errorf("the first field of %s must be a uint32 key that isn't nullable", s.Name)
+	}
+
+	seen := make(map[string]bool)
+	for _, field := range s.Fields {
+		if seen[strings.ToLower(field.Name)] {
+			return fmt.Errorf("field %s of %s is declared twice", field.Name, s.Name)
+		}
+		seen[strings.ToLower(field.Name)] = true
+
+		if err := field.validate(); err != nil {
+			return fmt.Errorf("error in %s: %w", s.Name, err)
+		}
+	}
+
+	if s.IsSlave() {
+		i := s.FieldIndex(s.ParentField)
+		if i <= 0 || s.Fields[i].Type != TypeUint32 {
+			return fmt.Errorf("parent field %s of %s must be a uint32 field other than the key", s.ParentField, s.Name)
+		}
+		if s.OnDelete == SetNull && !s.Fields[i].Nullable {
+			return fmt.Errorf("parent field %s of %s must be nullable to be set to NULL on delete", s.ParentField, s.Name)
+		}
+	} else if s.OnDelete != Cascade {
+		return fmt.Errorf("%s is not a slave table and can't have an on-delete action", s.Name)
+	}
+
+	if s.IsJunction() {
+		if err := s.validateLinks(); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range s.Indexed {
+		i := s.FieldIndex(name)
+		if i < 0 || (s.Fields[i].Type != TypeText && s.Fields[i].Type != TypeUint32) {
+			return fmt.Errorf("field %s of %s can't be indexed", name, s.Name)
+		}
+	}
+
+	for _, name := range s.Searchable {
+		i := s.FieldIndex(name)
+		if i < 0 || !s.Fields[i].IsText() {
+			return fmt.Errorf("field %s of %s can't be searched", name, s.Name)
+		}
+	}
+
+	for i, fields := range s.Unique {
+		if len(fields) == 0 {
+			return fmt.Errorf("unique constraint of %s has no fields", s.Name)
+		}
+		for j, name := range fields {
+			if s.FieldIndex(name) < 0 {
+				return fmt.Errorf("field %s of unique constraint was not found in %s", name, s.Name)
+			}
+			if containsName(fields[:j], name) {
+				return fmt.Errorf("field %s is repeated in a unique constraint of %s", name, s.Name)
+			}
+		}
+		if s.UniqueIndex(fields) != i {
+			return fmt.Errorf("unique constraint on %s of %s is declared twice", strings.Join(fields, ", "), s.Name)
+		}
+	}
+
+	return nil
+}
+
+// validateLinks checks that the junction table links two different tables through two uint32 fields other than the
+// key that aren't nullable and are indexed.
+func (s *Schema) validateLinks() error {
+	if len(s.Links) != 2 {
+		return fmt.Errorf("junction table %s must link exactly two tables, got %d", s.Name, len(s.Links))
+	}
+	if s.IsSlave() || s.IsMaster() {
+		return fmt.Errorf("junction table %s can't have a master table or slave tables", s.Name)
+	}
+	if s.Links[0].Table == s.Links[1].Table || strings.EqualFold(s.Links[0].Field, s.Links[1].Field) {
+		return fmt.Errorf("junction table %s must link two different tables through two different fields", s.Name)
+	}
+
+	for _, link := range s.Links {
+		i := s.FieldIndex(link.Field)
+		if i <= 0 || s.Fields[i].Type != TypeUint32 || s.Fields[i].Nullable {
+			return fmt.Errorf("link field %s of %s must be a uint32 field other than the key that isn't nullable",
+				link.Field, s.Name)
+		}
+		if !containsName(s.Indexed, link.Field) {
+			return fmt.Errorf("link field %s of %s must be indexed", link.Field, s.Name)
+		}
+	}
+
+	return nil
+}
+
+// Key returns the value of the key field.
+func (r *Record) Key() uint32 {
+	return r.Values[0].(uint32)
 }
 
-// Certificate is the certificate model.
-type Certificate struct {
-	ID       uint32
-	CourseID uint32
-	IssuedTo [30]byte
-	Slave
+// Present reports whether the record is not logically deleted.
+func (r *Record) Present() bool {
+	return r.Presence
 }
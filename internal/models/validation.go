@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validation decides what happens to text values that don't fit their fields.
+type Validation uint8
+
+const (
+	// Strict refuses values longer than their fields.
+	Strict Validation = iota
+	// Lenient cuts values longer than their fields at the last rune that fits.
+	Lenient
+)
+
+// validationNames maps validation modes to the names they are set with.
+var validationNames = map[Validation]string{
+	Strict:  "strict",
+	Lenient: "lenient",
+}
+
+// String returns the name of the validation mode.
+func (v Validation) String() string {
+	return validationNames[v]
+}
+
+// ParseValidation returns the validation mode with the given name.
+func ParseValidation(name string) (Validation, error) {
+	for v, validationName := range validationNames {
+		if strings.EqualFold(validationName, name) {
+			return v, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown validation mode %s, expected strict or lenient", name)
+}
+
+// ValidationError reports a value refused by a field.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid value for %s: %s", e.Field, e.Reason)
+}
+
+// validateText checks that the text can be stored in the field. Text must be valid UTF-8, and text of fixed-size
+// fields can't hold NUL bytes, which pad the stored value. Text longer than a fixed-size field is refused in strict
+// mode and cut at a rune boundary in lenient mode, in which case truncated is set.
+func (f Field) validateText(text string, validation Validation) (value string, truncated bool, err error) {
+	if !utf8.ValidString(text) {
+		return "", false, &ValidationError{Field: f.Name, Reason: "not valid UTF-8"}
+	}
+
+	if f.Type != TypeText {
+		return text, false, nil
+	}
+
+	if strings.ContainsRune(text, 0) {
+		return "", false, &ValidationError{Field: f.Name, Reason: "contains a NUL byte"}
+	}
+
+	if len(text) <= f.Size {
+		return text, false, nil
+	}
+
+	if validation == Strict {
+		return "", false, &ValidationError{
+			Field:  f.Name,
+			Reason: fmt.Sprintf("%d bytes long, at most %d fit", len(text), f.Size),
+		}
+	}
+
+	return TruncateText(text, f.Size), true, nil
+}
+
+// TruncateText cuts the text to at most size bytes without splitting a multi-byte rune.
+func TruncateText(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+
+	for size > 0 && !utf8.RuneStart(text[size]) {
+		size--
+	}
+
+	return text[:size]
+}